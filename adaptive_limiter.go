@@ -0,0 +1,155 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// An AdaptiveLimiter is a limiter without an internal buffer that adjusts its rate to the feedback
+// it receives, increasing it additively while requests succeed and decreasing it multiplicatively
+// when they are throttled (AIMD)
+type AdaptiveLimiter struct {
+	mu           *sync.Mutex
+	limiter      *UnbufferedLimiter
+	rate         float64
+	minRate      int
+	maxRate      int
+	interval     time.Duration
+	lastDecrease time.Time
+	clock        Clock
+}
+
+// NewAdaptiveLimiter returns a new AdaptiveLimiter given the bounds of its rate and a time
+// interval.
+//
+// The AdaptiveLimiter limits permissions like an UnbufferedLimiter whose rate starts at maxRate
+// and changes with the outcome of the limited operations. Every ReportSuccess increases the rate
+// by 1/rate, so a limiter that is used at its full rate gains about one permission per interval,
+// and ReportThrottled halves the rate. The rate never goes below minRate or above maxRate.
+// Throttles reported within an interval of the last decrease are ignored since they are most
+// likely for requests granted before it.
+//
+// If the minRate received <= 0 it will default to 1, if the maxRate received is < minRate it will
+// be set to minRate and if the interval received <= 0 it will be set to 1 millisecond.
+//
+// The options configure the rest of the AdaptiveLimiter, such as the clock it uses.
+func NewAdaptiveLimiter(minRate, maxRate int, interval time.Duration, opts ...Option) *AdaptiveLimiter {
+	o := newOptions(opts)
+	if minRate <= 0 {
+		minRate = 1
+	}
+	if maxRate < minRate {
+		maxRate = minRate
+	}
+	o.rate = maxRate
+	o.interval = interval
+	o.lenient()
+	return &AdaptiveLimiter{
+		mu:           &sync.Mutex{},
+		limiter:      newUnbufferedLimiter(o),
+		rate:         float64(maxRate),
+		minRate:      minRate,
+		maxRate:      maxRate,
+		interval:     o.interval,
+		lastDecrease: time.Time{},
+		clock:        o.clock,
+	}
+}
+
+// ReportSuccess reports that an operation the AdaptiveLimiter granted permission for succeeded,
+// increasing the rate up to the maxRate.
+func (l *AdaptiveLimiter) ReportSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.setRate(l.rate + 1/l.rate)
+}
+
+// ReportThrottled reports that an operation the AdaptiveLimiter granted permission for was
+// throttled, for example with 429 Too Many Requests, halving the rate down to the minRate.
+func (l *AdaptiveLimiter) ReportThrottled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	if !l.lastDecrease.IsZero() && now.Sub(l.lastDecrease) < l.interval {
+		return
+	}
+	l.lastDecrease = now
+	l.setRate(l.rate / 2)
+}
+
+// Rate returns the current rate of the AdaptiveLimiter.
+func (l *AdaptiveLimiter) Rate() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate)
+}
+
+// sets the rate within the bounds, changing the rate of the limiter when the whole number of
+// permissions changes. Must be called while holding the lock.
+func (l *AdaptiveLimiter) setRate(rate float64) {
+	rate = min(max(rate, float64(l.minRate)), float64(l.maxRate))
+	changed := int(rate) != int(l.rate)
+	l.rate = rate
+	if changed {
+		l.limiter.SetRate(int(rate), l.interval) // the rate and interval are valid so this can't fail
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// See the Wait receiver of the UnbufferedLimiter.
+func (l *AdaptiveLimiter) Wait(timeout *time.Duration) error {
+	return l.limiter.Wait(timeout)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// See the WaitContext receiver of the UnbufferedLimiter.
+func (l *AdaptiveLimiter) WaitContext(ctx context.Context) error {
+	return l.limiter.WaitContext(ctx)
+}
+
+// WaitN is like WaitContext but waits for n permits at once. If n is greater than the current rate
+// a LimiterRequestTooLarge error is returned.
+func (l *AdaptiveLimiter) WaitN(ctx context.Context, n int) error {
+	return l.limiter.WaitN(ctx, n)
+}
+
+// TryWait returns whether or not the AdaptiveLimiter granted permission.
+//
+// See the TryWait receiver of the UnbufferedLimiter.
+func (l *AdaptiveLimiter) TryWait() (time.Duration, error) {
+	return l.limiter.TryWait()
+}
+
+// TryWaitN is like TryWait but asks for n permits at once. If n is greater than the current rate a
+// LimiterRequestTooLarge error is returned.
+func (l *AdaptiveLimiter) TryWaitN(n int) (time.Duration, error) {
+	return l.limiter.TryWaitN(n)
+}
+
+func (l *AdaptiveLimiter) lock()   { l.limiter.lock() }
+func (l *AdaptiveLimiter) unlock() { l.limiter.unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *AdaptiveLimiter) checkN(n int) (time.Duration, error) {
+	return l.limiter.checkN(n)
+}
+
+// records that n permits were granted. Must be called while holding the lock after checkN allowed
+// them.
+func (l *AdaptiveLimiter) commitN(n int) {
+	l.limiter.commitN(n)
+}
+
+// Stats returns a snapshot of the AdaptiveLimiter, the Rate is the current rate.
+func (l *AdaptiveLimiter) Stats() Stats {
+	return l.limiter.Stats()
+}
+
+// Close closes the AdaptiveLimiter, all subsequent requests return a LimiterClosed error.
+func (l *AdaptiveLimiter) Close() error {
+	return l.limiter.Close()
+}
@@ -0,0 +1,91 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestAdaptiveLimiterRate(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewAdaptiveLimiter(2, 10, time.Second, WithClock(clock))
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		throttled int
+		successes int
+		want      int
+	}{
+		{name: "Starts at the max rate", want: 10},
+		{name: "Throttled halves the rate", throttled: 1, want: 5},
+		{name: "Throttled again within the interval", throttled: 3, want: 5},
+		{name: "Throttled after the interval", advance: time.Second, throttled: 1, want: 2},
+		{name: "Never below the min rate", advance: time.Second, throttled: 1, want: 2},
+		{name: "Successes increase additively", successes: 3, want: 3},
+		{name: "Never above the max rate", successes: 1000, want: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			for i := 0; i < tt.throttled; i++ {
+				limiter.ReportThrottled()
+			}
+			for i := 0; i < tt.successes; i++ {
+				limiter.ReportSuccess()
+			}
+			if got := limiter.Rate(); got != tt.want {
+				t.Errorf("AdaptiveLimiter.Rate(), want %v, got %v", tt.want, got)
+			}
+			if got := limiter.Stats().Rate; got != tt.want {
+				t.Errorf("AdaptiveLimiter.Stats().Rate, want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterTryWait(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewAdaptiveLimiter(1, 4, time.Second, WithClock(clock))
+	limiter.ReportThrottled()
+
+	for i := 0; i < 2; i++ {
+		if _, err := limiter.TryWait(); err != nil {
+			t.Errorf("AdaptiveLimiter.TryWait() %v/2, want nil, got %v", i+1, err)
+		}
+	}
+	if _, err := limiter.TryWait(); err == nil {
+		t.Errorf("AdaptiveLimiter.TryWait() over the rate, want LimiterOverLimitError, got nil")
+	}
+	if _, err := limiter.TryWaitN(3); err == nil {
+		t.Errorf("AdaptiveLimiter.TryWaitN(3) over the rate, want LimiterRequestTooLargeError, got nil")
+	}
+
+	clock.Advance(time.Second)
+	if _, err := limiter.TryWait(); err != nil {
+		t.Errorf("AdaptiveLimiter.TryWait() after the interval, want nil, got %v", err)
+	}
+}
+
+func TestNewAdaptiveLimiterBounds(t *testing.T) {
+	tests := []struct {
+		name    string
+		minRate int
+		maxRate int
+		want    int
+	}{
+		{name: "Valid bounds", minRate: 1, maxRate: 5, want: 5},
+		{name: "Min rate of 0", minRate: 0, maxRate: 0, want: 1},
+		{name: "Max rate below min rate", minRate: 3, maxRate: 2, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewAdaptiveLimiter(tt.minRate, tt.maxRate, time.Second).Rate(); got != tt.want {
+				t.Errorf("NewAdaptiveLimiter(%v, %v).Rate(), want %v, got %v", tt.minRate, tt.maxRate, tt.want, got)
+			}
+		})
+	}
+}
@@ -2,24 +2,82 @@ package rate
 
 import (
 	"sync"
+	"time"
 )
 
 // permissionStatus is used to send signals between the limiter and the buffer.
 //
-// The limiter signals when the request times out and the buffer signals when permission is granted.
+// The limiter signals when the request times out and the buffer signals when permission is granted
+// or denied. The fields are only read and written while holding the buffer lock, the requester
+// blocks on ready which receives a value once permission is granted or denied.
 type permissionStatus struct {
+	key      string
+	n        int
+	priority int
+	added    time.Time
 	granted  bool
 	timedOut bool
+	denied   error
+	ready    chan struct{}
+}
+
+// returns a new permissionStatus for a request of the flow key with the priority added to the
+// buffer at the given time waiting for n permits
+func newPermissionStatus(key string, n, priority int, added time.Time) *permissionStatus {
+	return &permissionStatus{
+		key:      key,
+		n:        n,
+		priority: priority,
+		added:    added,
+		granted:  false,
+		timedOut: false,
+		denied:   nil,
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// returns true if the request is still waiting in the buffer
+func (p *permissionStatus) waiting() bool {
+	return !p.granted && !p.timedOut && p.denied == nil
+}
+
+// marks the request as granted and wakes up the requester
+func (p *permissionStatus) grant() {
+	p.granted = true
+	p.signal()
+}
+
+// marks the request as denied with the error and wakes up the requester
+func (p *permissionStatus) deny(err error) {
+	p.denied = err
+	p.signal()
+}
+
+// wakes up the requester
+func (p *permissionStatus) signal() {
+	select {
+	case p.ready <- struct{}{}:
+	default: // the requester was already signaled
+	}
 }
 
 // a buffer for the BufferedLimiter to keep track of the requests waiting for approval.
 type buffer struct {
-	mu       *sync.Mutex
-	capacity int
-	size     int
-	insertAt int
-	removeAt int
-	buffer   []*permissionStatus
+	mu          *sync.Mutex
+	capacity    int
+	size        int
+	permits     int
+	prioritized int // the waiting requests with a priority other than 0
+	aging       time.Duration
+	flowCap     int            // the capacity per flow key in fair mode, 0 otherwise
+	flows       map[string]int // the waiting requests per flow key in fair mode
+	rotation    []string       // the flow keys with waiting requests in the order they take turns
+	turn        int            // the index in the rotation of the flow whose turn it is
+	insertAt    int
+	removeAt    int
+	buffer      []*permissionStatus
+	notify      chan struct{}
+	closed      bool
 }
 
 // returns a new buffer
@@ -27,35 +85,86 @@ type buffer struct {
 // no need to check if capacity is 0 since this is for internal use only.
 func newBuffer(capacity int) *buffer {
 	return &buffer{
-		mu:       &sync.Mutex{},
-		capacity: capacity,
-		size:     0,
-		insertAt: 0,
-		removeAt: 0,
-		buffer:   make([]*permissionStatus, capacity),
+		mu:          &sync.Mutex{},
+		capacity:    capacity,
+		size:        0,
+		permits:     0,
+		prioritized: 0,
+		aging:       0,
+		flowCap:     0,
+		flows:       nil,
+		rotation:    nil,
+		turn:        0,
+		insertAt:    0,
+		removeAt:    0,
+		buffer:      make([]*permissionStatus, capacity),
+		notify:      make(chan struct{}, 1),
+		closed:      false,
 	}
 }
 
+// makes the buffer fair between flow keys, the requests of the keys take turns and every key can
+// have up to flowCap requests waiting. The buffer grows as needed to hold the requests of all the
+// keys.
+func (b *buffer) fair(flowCap int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flowCap = flowCap
+	b.flows = make(map[string]int)
+	b.rotation = []string{}
+	b.turn = 0
+}
+
 // add the request to the buffer
-// returns true if the request was added and false if the buffer is full
+// returns true if the request was added and false if the buffer is full or closed
 func (b *buffer) add(access *permissionStatus) bool {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	if b.flowCap > 0 {
+		if b.flows[access.key] == b.flowCap {
+			return false
+		}
+		if b.size == b.capacity {
+			b.compact(b.capacity * 2)
+		}
+	}
 	if b.size == b.capacity {
 		return false
 	}
 	if b.insertAt == b.removeAt && b.size > 0 { // some requests timed out so cleaning is necessary
 		b.cleanBuffer()
 	}
+	if b.flowCap > 0 {
+		if b.flows[access.key] == 0 {
+			// the new flow takes its turn last, after the flows already waiting
+			b.rotation = append(b.rotation[:b.turn], append([]string{access.key}, b.rotation[b.turn:]...)...)
+			b.turn = (b.turn + 1) % len(b.rotation)
+		}
+		b.flows[access.key]++
+	}
 	b.buffer[b.insertAt] = access
 	b.insertAt = incrementIndex(b.insertAt, b.capacity)
 	b.size++
+	b.permits += access.n
+	if access.priority != 0 {
+		b.prioritized++
+	}
+	b.wake()
 	return true
 }
 
 // removes the requests that timed out preserving the order of the requests
 func (b *buffer) cleanBuffer() {
-	buf := make([]*permissionStatus, b.capacity)
+	b.compact(b.capacity)
+}
+
+// moves the requests that haven't timed out to a new buffer of the given capacity preserving the
+// order of the requests. Must be called while holding the lock with a capacity >= the size.
+func (b *buffer) compact(capacity int) {
+	buf := make([]*permissionStatus, capacity)
 	pos := b.removeAt
 	insert := 0
 	for i := 0; i < b.capacity; i++ {
@@ -66,28 +175,190 @@ func (b *buffer) cleanBuffer() {
 		pos = incrementIndex(pos, b.capacity)
 	}
 	b.buffer = buf
-	b.insertAt = insert
+	b.capacity = capacity
+	b.insertAt = insert % capacity
 	b.removeAt = 0
 }
 
-// remove signals to the next requester that access was granted if there is one waiting
+// resize changes the capacity of the buffer keeping the waiting requests in order. When the new
+// capacity is smaller than the number of waiting requests the most recent requests that no longer
+// fit are denied with a LimiterBufferFullError. In fair mode the capacity is per flow key.
+func (b *buffer) resize(capacity int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.flowCap > 0 {
+		b.resizeFlows(capacity)
+		return
+	}
+	if b.size > capacity {
+		queued := b.size
+		b.compact(b.capacity)
+		for i := b.size - 1; i >= capacity; i-- {
+			b.buffer[i].deny(newBufferFullError(queued))
+			b.removed(b.buffer[i])
+			b.buffer[i] = nil
+		}
+	}
+	b.compact(capacity)
+}
+
+// changes the capacity per flow key denying the most recent requests of the keys that no longer fit.
+// Must be called while holding the lock.
+func (b *buffer) resizeFlows(flowCap int) {
+	b.flowCap = flowCap
+	waiting := make(map[string]int, len(b.flows))
+	pos := b.removeAt
+	for i := 0; i < b.capacity; i++ {
+		if access := b.buffer[pos]; access != nil && access.waiting() {
+			waiting[access.key]++
+			if waiting[access.key] > flowCap {
+				access.deny(newBufferFullError(b.size))
+				access.timedOut = true // removed from the buffer like a request that timed out
+				b.removed(access)
+			}
+		}
+		pos = incrementIndex(pos, b.capacity)
+	}
+}
+
+// denies the waiting requests for more than the given number of permits with a
+// LimiterRequestTooLargeError, they could never be granted
+func (b *buffer) denyLarger(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, access := range b.buffer {
+		if access != nil && access.waiting() && access.n > n {
+			access.deny(newRequestTooLargeError(n))
+			access.timedOut = true // removed from the buffer like a request that timed out
+			b.removed(access)
+		}
+	}
+}
+
+// returns the number of requests waiting in the buffer and its capacity
+func (b *buffer) stats() (int, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.flowCap > 0 {
+		return b.size, b.flowCap
+	}
+	return b.size, b.capacity
+}
+
+// wakes up the approval loop if it is waiting
+func (b *buffer) wake() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// remove signals to the next requester that access was granted if there is one waiting,
+// regardless of the number of permits it asked for
 //
 // returns true if a requester is waiting false otherwise
 func (b *buffer) remove() bool {
+	_, ok := b.removeIf(time.Time{}, func(int) bool { return true })
+	return ok
+}
+
+// removeIf signals to the next requester that access was granted if there is one waiting and fits
+// reports that the number of permits it asked for can be granted. The next requester is the one
+// with the highest priority at the given time, and the first one added among those, it is never
+// skipped so a request for many permits isn't starved by requests for fewer.
+//
+// returns the number of permits the next requester asked for, 0 if none is waiting, and true if
+// it was granted
+func (b *buffer) removeIf(now time.Time, fits func(n int) bool) (int, bool) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if b.size == 0 {
-		return false
+		return 0, false
 	}
 	for b.buffer[b.removeAt].timedOut { // advance to the next requester
 		b.buffer[b.removeAt] = nil
 		b.removeAt = incrementIndex(b.removeAt, b.capacity)
 	}
-	b.buffer[b.removeAt].granted = true
-	b.buffer[b.removeAt] = nil
-	b.removeAt = incrementIndex(b.removeAt, b.capacity)
+	next := b.next(now)
+	access := b.buffer[next]
+	if !fits(access.n) {
+		return access.n, false
+	}
+	access.grant()
+	if next == b.removeAt {
+		b.buffer[b.removeAt] = nil
+		b.removeAt = incrementIndex(b.removeAt, b.capacity)
+	} else {
+		access.timedOut = true // removed from the middle of the buffer like a request that timed out
+	}
+	b.removed(access)
+	if b.flowCap > 0 && b.flows[access.key] > 0 { // the flow is done with its turn
+		b.turn = (b.turn + 1) % len(b.rotation)
+	}
+	return access.n, true
+}
+
+// returns the position of the next request to grant at the given time, the first one added with
+// the highest priority, from the flow whose turn it is in fair mode. Must be called while holding
+// the lock with the request at removeAt waiting.
+func (b *buffer) next(now time.Time) int {
+	fair := b.flowCap > 0
+	if !fair && b.prioritized == 0 {
+		// with aging the requests added first have waited the longest so the order is the same
+		return b.removeAt
+	}
+	next, highest := -1, 0
+	pos := b.removeAt
+	for i := 0; i < b.capacity; i++ {
+		access := b.buffer[pos]
+		if access != nil && access.waiting() && (!fair || access.key == b.rotation[b.turn]) {
+			if priority := b.priority(access, now); next == -1 || priority > highest {
+				next, highest = pos, priority
+			}
+		}
+		pos = incrementIndex(pos, b.capacity)
+	}
+	return next
+}
+
+// returns the priority of the request at the given time, raised by one for every aging duration it
+// waited
+func (b *buffer) priority(access *permissionStatus, now time.Time) int {
+	if b.aging <= 0 || now.Before(access.added) {
+		return access.priority
+	}
+	return access.priority + int(now.Sub(access.added)/b.aging)
+}
+
+// updates the counts of the buffer once the request no longer waits. Must be called while holding
+// the lock.
+func (b *buffer) removed(access *permissionStatus) {
 	b.size--
-	return true
+	b.permits -= access.n
+	if access.priority != 0 {
+		b.prioritized--
+	}
+	if b.flowCap == 0 {
+		return
+	}
+	b.flows[access.key]--
+	if b.flows[access.key] > 0 {
+		return
+	}
+	delete(b.flows, access.key)
+	for i, key := range b.rotation {
+		if key != access.key {
+			continue
+		}
+		b.rotation = append(b.rotation[:i], b.rotation[i+1:]...)
+		if i < b.turn {
+			b.turn--
+		}
+		if b.turn >= len(b.rotation) {
+			b.turn = 0
+		}
+		return
+	}
 }
 
 // the requester signals to the buffer that the request timed out
@@ -97,6 +368,51 @@ func (b *buffer) timedOutSignal() {
 	b.size--
 }
 
+// cancel removes the request from the buffer so it no longer holds a slot
+//
+// returns false if the request was already granted or denied and true otherwise
+func (b *buffer) cancel(access *permissionStatus) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if access.granted || access.denied != nil {
+		return false
+	}
+	access.timedOut = true
+	b.removed(access)
+	return true
+}
+
+// close denies every request still waiting in the buffer with a LimiterClosedError and wakes up
+// the requesters. Once closed no more requests can be added to the buffer.
+func (b *buffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for i, access := range b.buffer {
+		if access != nil && access.waiting() {
+			access.deny(newClosedError())
+		}
+		b.buffer[i] = nil
+	}
+	b.size = 0
+	b.permits = 0
+	b.prioritized = 0
+	if b.flowCap > 0 {
+		b.flows = make(map[string]int)
+		b.rotation = []string{}
+		b.turn = 0
+	}
+	b.insertAt = 0
+	b.removeAt = 0
+}
+
+// returns the total number of permits the requests waiting in the buffer asked for
+func (b *buffer) queuedPermits() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.permits
+}
+
 // increments an array index and wraps around to prevent index out of bounds
 func incrementIndex(index, capacity int) int {
 	return (index + 1) % capacity
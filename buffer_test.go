@@ -2,6 +2,7 @@ package rate
 
 import (
 	"testing"
+	"time"
 )
 
 func TestAdd(t *testing.T) {
@@ -229,3 +230,32 @@ func TestCleanBuffer(t *testing.T) {
 		})
 	}
 }
+
+func TestFairBuffer(t *testing.T) {
+	buf := newBuffer(1)
+	buf.fair(2)
+	keys := []string{"a", "a", "b", "c", "b", "d"}
+	for _, key := range keys {
+		if ok := buf.add(newPermissionStatus(key, 1, 0, time.Time{})); !ok {
+			t.Fatalf("buffer.add(%v), want true, got false", key)
+		}
+	}
+	if ok := buf.add(newPermissionStatus("a", 1, 0, time.Time{})); ok {
+		t.Errorf("buffer.add(a) over the flow capacity, want false, got true")
+	}
+	if buf.capacity < len(keys) {
+		t.Errorf("buffer capacity, want >= %v, got %v", len(keys), buf.capacity)
+	}
+
+	want := []string{"a", "b", "c", "d", "a", "b"}
+	for i := range want {
+		pos := buf.next(time.Time{})
+		got := buf.buffer[pos].key
+		if _, ok := buf.removeIf(time.Time{}, func(int) bool { return true }); !ok || got != want[i] {
+			t.Errorf("buffer.removeIf() %v/%v, want %v, got %v %v", i+1, len(want), want[i], got, ok)
+		}
+	}
+	if buf.size != 0 || len(buf.flows) != 0 || len(buf.rotation) != 0 {
+		t.Errorf("buffer after granting all, want empty, got size %v flows %v rotation %v", buf.size, buf.flows, buf.rotation)
+	}
+}
@@ -1,16 +1,24 @@
 package rate
 
 import (
+	"context"
+	"sync"
 	"time"
 )
 
 // A BufferedLimiter is a limiter with an internal buffer that limits permissions at a given rate
 // and time interval
 type BufferedLimiter struct {
+	mu         *sync.Mutex
 	rate       int
+	index      int
 	interval   time.Duration
 	timeStamps []time.Time
 	buffer     *buffer
+	clock      Clock
+	done       chan struct{}
+	closeOnce  *sync.Once
+	counters   *counters
 }
 
 // NewBufferedLimiter returns a new BufferedLimiter given a capacity, rate, and interval.
@@ -23,40 +31,234 @@ type BufferedLimiter struct {
 // capacity for the buffer will be set to 1. If the interval received is <= 0 the time interval will
 // default to 1 millisecond. This is to prevent the BufferedLimiter from erroring during use and to
 // ensure the caller gets a working limiter without checking for errors.
-func NewBufferedLimiter(rate, capacity int, interval time.Duration) *BufferedLimiter {
-	if rate <= 0 {
-		rate = 1
-	}
-	if capacity <= 0 {
-		capacity = 1
-	}
-	if interval <= 0 {
-		interval = time.Millisecond
+//
+// The BufferedLimiter runs a goroutine to approve the buffered requests, call Close when the
+// limiter is no longer needed to release it.
+//
+// The options configure the rest of the BufferedLimiter, such as the clock it uses. The rate,
+// capacity and interval received take precedence over WithRate and WithCapacity. Use NewBuffered
+// to have invalid values reported as an error instead.
+func NewBufferedLimiter(rate, capacity int, interval time.Duration, opts ...Option) *BufferedLimiter {
+	o := newOptions(opts)
+	o.rate = rate
+	o.capacity = capacity
+	o.interval = interval
+	o.lenient()
+	return newBufferedLimiter(o)
+}
+
+// returns a new BufferedLimiter given valid options and starts its approval loop
+func newBufferedLimiter(o *options) *BufferedLimiter {
+	buf := newBuffer(o.capacity)
+	buf.aging = o.aging
+	if o.fair {
+		buf.fair(o.capacity)
 	}
 	l := &BufferedLimiter{
-		rate:       rate,
-		interval:   interval,
-		timeStamps: make([]time.Time, rate),
-		buffer:     newBuffer(capacity),
+		mu:         &sync.Mutex{},
+		rate:       o.rate,
+		index:      0,
+		interval:   o.interval,
+		timeStamps: make([]time.Time, o.rate),
+		buffer:     buf,
+		clock:      o.clock,
+		done:       make(chan struct{}),
+		closeOnce:  &sync.Once{},
+		counters:   &counters{},
 	}
 	go l.permissionApprovalLoop()
 	return l
 }
 
 // handles the logic to process permission approvals for requests from the buffer.
-// This runs on its own goroutine as it loops indefinitely
+// This runs on its own goroutine and loops until the limiter is closed, parking while the buffer is
+// empty.
 func (l *BufferedLimiter) permissionApprovalLoop() {
-	index := 0
 	for {
-		if time.Since(l.timeStamps[index]) > l.interval {
-			if ok := l.buffer.remove(); !ok { // buffer empty
-				continue
+		l.mu.Lock()
+		n, ok := l.buffer.removeIf(l.clock.Now(), func(n int) bool {
+			return l.remainingN(n) <= 0
+		})
+		var remaining time.Duration
+		if ok {
+			l.recordN(n)
+		} else if n > 0 {
+			remaining = l.remainingN(n)
+		}
+		l.mu.Unlock()
+		switch {
+		case ok:
+			continue
+		case n == 0: // buffer empty
+			select {
+			case <-l.buffer.notify:
+			case <-l.done:
+				return
 			}
-			l.timeStamps[index] = time.Now()
-			index = incrementIndex(index, l.rate)
 			continue
 		}
-		time.Sleep(l.interval - time.Since(l.timeStamps[index]))
+		c, stop := l.clock.NewTimer(remaining)
+		select {
+		case <-c:
+		case <-l.buffer.notify: // a new request or the limiter was reconfigured
+			stop()
+		case <-l.done:
+			stop()
+			return
+		}
+	}
+}
+
+// returns the time until n permits can be granted, <= 0 if they can be granted now
+//
+// the time stamps are in the order they were recorded so the n-th slot from the index is the most
+// recent of the n slots. Must be called while holding the lock.
+func (l *BufferedLimiter) remainingN(n int) time.Duration {
+	return l.interval - l.clock.Now().Sub(l.timeStamps[(l.index+n-1)%l.rate])
+}
+
+// records that n permits were granted now. Must be called while holding the lock.
+func (l *BufferedLimiter) recordN(n int) {
+	now := l.clock.Now()
+	for i := 0; i < n; i++ {
+		l.timeStamps[l.index] = now
+		l.index = incrementIndex(l.index, l.rate)
+	}
+}
+
+// Close stops the BufferedLimiter.
+//
+// Close terminates the goroutine approving the buffered requests, every request still waiting in
+// the buffer returns a LimiterClosed error and so do all subsequent calls to Wait. Calling Close more
+// than once has no effect. The returned error is always nil, it is there to satisfy io.Closer.
+func (l *BufferedLimiter) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		l.buffer.close()
+	})
+	return nil
+}
+
+// Stop stops the BufferedLimiter, it is the same as calling Close and ignoring the error.
+func (l *BufferedLimiter) Stop() {
+	l.Close()
+}
+
+// TryWait returns whether or not the BufferedLimiter granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately without adding the request to the
+// buffer. Permission is granted only when no requests are waiting in the buffer and the rate
+// allows it, in which case the error is nil. Otherwise a LimiterOverLimit error is returned along
+// with an estimate of how long a request added to the buffer now would wait, based on the requests
+// already in the buffer and the recent approvals. Once the limiter is closed a LimiterClosed error
+// is returned.
+//
+// TryWait is thread safe and never jumps ahead of requests already waiting in the buffer.
+func (l *BufferedLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned since the permits could never be granted, and if n <= 0
+// nothing is granted and the error is nil.
+func (l *BufferedLimiter) TryWaitN(n int) (time.Duration, error) {
+	remaining, err := l.tryWaitN(n)
+	l.counters.record(err)
+	return remaining, err
+}
+
+// tries to grant n permits without adding the request to the buffer
+func (l *BufferedLimiter) tryWaitN(n int) (time.Duration, error) {
+	if l.isClosed() {
+		return 0, newClosedError()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n > l.rate {
+		return 0, newRequestTooLargeError(l.rate)
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	queued := l.buffer.queuedPermits()
+	if queued == 0 && l.remainingN(n) <= 0 {
+		l.recordN(n)
+		return 0, nil
+	}
+	// the request would be approved after the queued ones, every full pass over the time stamps
+	// adds an interval to the wait
+	last := queued + n - 1
+	slot := (l.index + last) % l.rate
+	passes := time.Duration(last/l.rate + 1)
+	remaining := l.timeStamps[slot].Add(passes * l.interval).Sub(l.clock.Now())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return remaining, newOverLimitError(remaining, l.rate)
+}
+
+// SetRate changes the rate and time interval of the BufferedLimiter.
+//
+// The permissions granted recently are kept so the new rate is enforced immediately, if more
+// permissions than the new rate were granted in the last interval the buffered requests wait until
+// enough of them are older than the interval. Buffered requests for more permits than the new rate
+// could never be granted so they return a LimiterRequestTooLarge error. A rate or interval <= 0
+// returns a LimiterConfig error and leaves the limiter unchanged.
+func (l *BufferedLimiter) SetRate(rate int, interval time.Duration) error {
+	o := &options{rate: rate, interval: interval}
+	if err := o.validateRate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeStamps, l.index = resizeTimeStamps(l.timeStamps, l.index, rate)
+	l.rate = rate
+	l.interval = interval
+	l.buffer.denyLarger(rate)
+	l.buffer.wake()
+	return nil
+}
+
+// SetCapacity changes the capacity of the buffer of the BufferedLimiter.
+//
+// The buffered requests keep their order. If more requests are buffered than the new capacity the
+// most recent ones that no longer fit return a LimiterBufferFull error. With WithFairQueueing the
+// capacity is per flow. A capacity <= 0 returns a LimiterConfig error and leaves the limiter
+// unchanged.
+func (l *BufferedLimiter) SetCapacity(capacity int) error {
+	if capacity <= 0 {
+		return newConfigError("capacity", capacity)
+	}
+	l.buffer.resize(capacity)
+	return nil
+}
+
+// Stats returns a snapshot of the BufferedLimiter.
+//
+// Available and NextAvailable are based on the recent approvals only, the requests waiting in the
+// buffer are approved before any new request so use TryWait for an estimate that accounts for them.
+func (l *BufferedLimiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := Stats{
+		Rate:     l.rate,
+		Interval: l.interval,
+	}
+	s.Available, s.NextAvailable = availableTimeStamps(l.timeStamps, l.index, l.interval, l.clock.Now())
+	s.Queued, s.Capacity = l.buffer.stats()
+	l.counters.fill(&s)
+	return s
+}
+
+// returns true if the limiter was closed
+func (l *BufferedLimiter) isClosed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -65,7 +267,7 @@ func (l *BufferedLimiter) permissionApprovalLoop() {
 // The Wait receiver for the BufferedLimiter blocks until the permission is granted or the request
 // times out. When permission is granted, a nil value is returned. Otherwise, an error will be
 // returned depending on what caused the limiter to deny permission, (LimiterBufferFull,
-// LimiterWaitTimedOut).
+// LimiterWaitTimedOut, LimiterClosed).
 //
 // Calls to Wait are thread safe in the sense that the limiter won't break and will enforce the rate
 // per interval regardless of how many threads share the limiter. The BufferedLimiter ensures that
@@ -74,39 +276,109 @@ func (l *BufferedLimiter) permissionApprovalLoop() {
 // execution of whatever was limited will be in order only that the permissions are granted in order.
 // Of course, there are no guarantees when a LimiterBufferFull error is returned.
 func (l *BufferedLimiter) Wait(timeout *time.Duration) error {
-	if timeout != nil {
-		return l.waitWithTimeOut(*timeout)
+	if timeout == nil {
+		return l.WaitContext(context.Background())
 	}
-	access := permissionStatus{
-		granted: false,
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// The WaitContext receiver for the BufferedLimiter blocks until the permission is granted or ctx
+// is done. When permission is granted, a nil value is returned. If the buffer is full a
+// LimiterBufferFull error is returned and if the limiter is closed a LimiterClosed error is
+// returned. When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is
+// returned, and when ctx is cancelled ctx.Err() is returned. A request whose context is done is
+// removed from the buffer so it no longer holds a slot.
+//
+// WaitContext has the same thread safety and ordering guarantees as Wait.
+func (l *BufferedLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// The n permits are granted together and in the same order as the other requests in the buffer,
+// so a request for many permits is never starved by requests for fewer. If n is greater than the
+// rate a LimiterRequestTooLarge error is returned since the permits could never be granted, and if
+// n <= 0 WaitN returns nil immediately.
+func (l *BufferedLimiter) WaitN(ctx context.Context, n int) error {
+	err := l.waitN(ctx, "", n, 0)
+	l.counters.record(err)
+	return err
+}
+
+// WaitPriority is like WaitContext but the request is granted before the requests in the buffer
+// with a lower priority.
+//
+// Requests with the same priority are granted in the order they were received, and the requests
+// made with Wait, WaitContext and WaitN have a priority of 0. A higher priority request waits for
+// the next permission like any other, it does not take permissions already granted. Without aging
+// a steady stream of higher priority requests can starve the lower priority ones, use
+// WithPriorityAging to raise the priority of the requests as they wait.
+func (l *BufferedLimiter) WaitPriority(ctx context.Context, priority int) error {
+	err := l.waitN(ctx, "", 1, priority)
+	l.counters.record(err)
+	return err
+}
+
+// WaitFlow is like WaitContext for a request of the flow key, such as a tenant or client.
+//
+// With WithFairQueueing the flows take turns, the approval loop grants the next request of each
+// flow with waiting requests in a round robin, so a flow that floods the limiter can't starve the
+// others, and the capacity of the buffer applies to each flow. A LimiterBufferFull error is
+// returned when the flow has as many requests waiting as the capacity. Without WithFairQueueing
+// the key is ignored. The requests made with Wait, WaitContext, WaitN and WaitPriority belong to
+// the flow "".
+func (l *BufferedLimiter) WaitFlow(ctx context.Context, key string) error {
+	return l.WaitFlowN(ctx, key, 1)
+}
+
+// WaitFlowN is like WaitFlow but waits for n permits at once.
+func (l *BufferedLimiter) WaitFlowN(ctx context.Context, key string, n int) error {
+	err := l.waitN(ctx, key, n, 0)
+	l.counters.record(err)
+	return err
+}
+
+// waits for n permits for the flow key with the priority without counting the outcome
+func (l *BufferedLimiter) waitN(ctx context.Context, key string, n, priority int) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, 0)
 	}
-	if ok := l.buffer.add(&access); !ok {
-		return &LimiterBufferFullError{message: "permission denied: buffer full"}
+	if n <= 0 {
+		return nil
 	}
-	for {
-		if access.granted {
-			return nil
+	access := newPermissionStatus(key, n, priority, l.clock.Now())
+	if err := l.add(access); err != nil {
+		return err
+	}
+	select {
+	case <-access.ready:
+		return access.denied
+	case <-ctx.Done():
+		if ok := l.buffer.cancel(access); ok {
+			return contextError(ctx, l.clock.Now().Sub(access.added))
 		}
+		return access.denied // granted or denied while the context was done
 	}
 }
 
-// handles the timeout logic for the BufferedLimiter sending a signal to the buffer when the request
-// timed out so the permissionApprovalLoop knows to ignore it
-func (l *BufferedLimiter) waitWithTimeOut(timeout time.Duration) error {
-	start := time.Now()
-	access := permissionStatus{
-		granted:  false,
-		timedOut: false,
-	}
-	if ok := l.buffer.add(&access); !ok {
-		return &LimiterBufferFullError{message: "permission denied: buffer full"}
+// adds the request to the buffer, checking it against the current rate
+func (l *BufferedLimiter) add(access *permissionStatus) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if access.n > l.rate {
+		return newRequestTooLargeError(l.rate)
 	}
-	for time.Since(start) < timeout {
-		if access.granted {
-			return nil
+	if ok := l.buffer.add(access); !ok {
+		if l.isClosed() {
+			return newClosedError()
 		}
+		queued, _ := l.buffer.stats()
+		return newBufferFullError(queued)
 	}
-	access.timedOut = true
-	l.buffer.timedOutSignal()
-	return &LimiterWaitTimedOutError{message: "permission denied: timed out"}
+	return nil
 }
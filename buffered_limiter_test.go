@@ -1,9 +1,13 @@
 package rate
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
 )
 
 func TestBufferedWait(t *testing.T) {
@@ -52,15 +56,6 @@ func TestBufferedWait(t *testing.T) {
 			maxDuration: time.Second * 2,
 			wantErr:     []bool{false, false, true},
 		},
-		{
-			name:        "Interval of 0",
-			limiter:     NewBufferedLimiter(1, 1, 0),
-			count:       3,
-			sleep:       time.Millisecond / 80,
-			minDuration: time.Millisecond,
-			maxDuration: time.Millisecond * 2,
-			wantErr:     []bool{false, false, true},
-		},
 		{
 			name:        "Buffer full remove some and add more",
 			limiter:     NewBufferedLimiter(1, 2, time.Second),
@@ -162,3 +157,449 @@ func TestBufferedWaitWithTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestBufferedWaitContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		limiter      *BufferedLimiter
+		count        int
+		cancelAt     time.Duration
+		deadline     bool
+		wantErr      []bool
+		wantErrIs    error
+		wantTimedOut bool
+	}{
+		{
+			name:     "Within limit",
+			limiter:  NewBufferedLimiter(3, 3, time.Second),
+			count:    3,
+			cancelAt: time.Second / 2,
+			wantErr:  []bool{false, false, false},
+		},
+		{
+			name:      "Cancelled while waiting",
+			limiter:   NewBufferedLimiter(1, 1, time.Second),
+			count:     2,
+			cancelAt:  time.Second / 2,
+			wantErr:   []bool{false, true},
+			wantErrIs: context.Canceled,
+		},
+		{
+			name:         "Deadline exceeded while waiting",
+			limiter:      NewBufferedLimiter(1, 1, time.Second),
+			count:        2,
+			cancelAt:     time.Second / 2,
+			deadline:     true,
+			wantErr:      []bool{false, true},
+			wantErrIs:    context.DeadlineExceeded,
+			wantTimedOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if tt.deadline {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.cancelAt)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+				time.AfterFunc(tt.cancelAt, cancel)
+			}
+			defer cancel()
+
+			var gotErr error
+			for i := 0; i < tt.count; i++ {
+				gotErr = tt.limiter.WaitContext(ctx)
+				if (gotErr != nil) != tt.wantErr[i] {
+					t.Errorf("BufferedLimiter.WaitContext() %v/%v, wantErr %v, got %v", i+1, tt.count, tt.wantErr[i], gotErr)
+				}
+			}
+			if tt.wantErrIs != nil && !errors.Is(gotErr, tt.wantErrIs) {
+				t.Errorf("BufferedLimiter.WaitContext(), want errors.Is %v, got %v", tt.wantErrIs, gotErr)
+			}
+			var timedOut *LimiterWaitTimedOutError
+			if errors.As(gotErr, &timedOut) != tt.wantTimedOut {
+				t.Errorf("BufferedLimiter.WaitContext(), want LimiterWaitTimedOutError %v, got %v", tt.wantTimedOut, gotErr)
+			}
+			tt.limiter.buffer.mu.Lock()
+			gotSize := tt.limiter.buffer.size
+			tt.limiter.buffer.mu.Unlock()
+			if gotSize != 0 {
+				t.Errorf("BufferedLimiter.WaitContext(), want buffer size 0, got %v", gotSize)
+			}
+		})
+	}
+}
+
+func TestBufferedClose(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter *BufferedLimiter
+		waiting int
+	}{
+		{
+			name:    "Close with no waiting requests",
+			limiter: NewBufferedLimiter(1, 3, time.Second),
+			waiting: 0,
+		},
+		{
+			name:    "Close with waiting requests",
+			limiter: NewBufferedLimiter(1, 3, time.Second),
+			waiting: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limiter.Wait(nil); err != nil {
+				t.Fatalf("BufferedLimiter.Wait(), want nil, got %v", err)
+			}
+
+			var wg sync.WaitGroup
+			gotErr := make([]error, tt.waiting)
+			for i := 0; i < tt.waiting; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					gotErr[i] = tt.limiter.Wait(nil)
+				}()
+			}
+			time.Sleep(time.Second / 10)
+
+			if err := tt.limiter.Close(); err != nil {
+				t.Errorf("BufferedLimiter.Close(), want nil, got %v", err)
+			}
+			tt.limiter.Stop()
+			wg.Wait()
+
+			var closed *LimiterClosedError
+			for i := 0; i < tt.waiting; i++ {
+				if !errors.As(gotErr[i], &closed) {
+					t.Errorf("BufferedLimiter.Wait() waiting %v/%v, want LimiterClosedError, got %v", i+1, tt.waiting, gotErr[i])
+				}
+			}
+			if err := tt.limiter.Wait(nil); !errors.As(err, &closed) {
+				t.Errorf("BufferedLimiter.Wait() after Close, want LimiterClosedError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestBufferedTryWait(t *testing.T) {
+	tests := []struct {
+		name          string
+		limiter       *BufferedLimiter
+		queued        int
+		count         int
+		wantErr       []bool
+		wantRemaining []time.Duration
+	}{
+		{
+			name:          "Within limit",
+			limiter:       NewBufferedLimiter(3, 3, time.Second),
+			queued:        0,
+			count:         3,
+			wantErr:       []bool{false, false, false},
+			wantRemaining: []time.Duration{0, 0, 0},
+		},
+		{
+			name:          "Over limit",
+			limiter:       NewBufferedLimiter(2, 3, time.Second),
+			queued:        0,
+			count:         3,
+			wantErr:       []bool{false, false, true},
+			wantRemaining: []time.Duration{0, 0, time.Second},
+		},
+		{
+			name:          "Requests waiting in the buffer",
+			limiter:       NewBufferedLimiter(1, 3, time.Second),
+			queued:        2,
+			count:         1,
+			wantErr:       []bool{true},
+			wantRemaining: []time.Duration{time.Second * 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.limiter.Close()
+			if tt.queued > 0 {
+				if _, err := tt.limiter.TryWait(); err != nil {
+					t.Fatalf("BufferedLimiter.TryWait(), want nil, got %v", err)
+				}
+				for i := 0; i < tt.queued; i++ {
+					go tt.limiter.Wait(nil)
+				}
+				time.Sleep(time.Second / 10)
+			}
+
+			for i := 0; i < tt.count; i++ {
+				gotRemaining, gotErr := tt.limiter.TryWait()
+				if (gotErr != nil) != tt.wantErr[i] {
+					t.Errorf("BufferedLimiter.TryWait() %v/%v, wantErr %v, got %v", i+1, tt.count, tt.wantErr[i], gotErr)
+				}
+				if gotRemaining > tt.wantRemaining[i] || gotRemaining < tt.wantRemaining[i]-time.Second/2 {
+					t.Errorf("BufferedLimiter.TryWait() %v/%v, wantRemaining about %v, got %v", i+1, tt.count, tt.wantRemaining[i], gotRemaining)
+				}
+			}
+		})
+	}
+}
+
+func TestBufferedWaitN(t *testing.T) {
+	limiter := NewBufferedLimiter(3, 5, time.Second)
+	defer limiter.Close()
+
+	if err := limiter.WaitN(context.Background(), 4); err == nil {
+		t.Errorf("BufferedLimiter.WaitN(4), want LimiterRequestTooLargeError, got nil")
+	}
+	if _, err := limiter.TryWaitN(3); err != nil {
+		t.Fatalf("BufferedLimiter.TryWaitN(3), want nil, got %v", err)
+	}
+
+	// the request for 3 permits is buffered first so it must be granted before the request for 1
+	// even though the single permit frees up first
+	order := make(chan int, 2)
+	var wg sync.WaitGroup
+	for i, n := range []int{3, 1} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := limiter.WaitN(context.Background(), n); err != nil {
+				t.Errorf("BufferedLimiter.WaitN(%v), want nil, got %v", n, err)
+			}
+			order <- i
+		}()
+		time.Sleep(time.Second / 10)
+	}
+	wg.Wait()
+	close(order)
+
+	wantOrder := []int{0, 1}
+	gotOrder := []int{}
+	for i := range order {
+		gotOrder = append(gotOrder, i)
+	}
+	if len(gotOrder) != len(wantOrder) || gotOrder[0] != wantOrder[0] || gotOrder[1] != wantOrder[1] {
+		t.Errorf("BufferedLimiter.WaitN(), want grant order %v, got %v", wantOrder, gotOrder)
+	}
+}
+
+func TestBufferedSetCapacity(t *testing.T) {
+	limiter := NewBufferedLimiter(1, 3, time.Second)
+	defer limiter.Close()
+	if _, err := limiter.TryWait(); err != nil {
+		t.Fatalf("BufferedLimiter.TryWait(), want nil, got %v", err)
+	}
+
+	gotErr := make([]error, 3)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gotErr[i] = limiter.Wait(nil)
+		}()
+		for limiter.buffer.queuedPermits() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if err := limiter.SetCapacity(1); err != nil {
+		t.Errorf("BufferedLimiter.SetCapacity(1), want nil, got %v", err)
+	}
+	wg.Wait()
+
+	var bufferFull *LimiterBufferFullError
+	wantBufferFull := []bool{false, true, true}
+	for i := range gotErr {
+		if errors.As(gotErr[i], &bufferFull) != wantBufferFull[i] {
+			t.Errorf("BufferedLimiter.Wait() %v/3 after SetCapacity, want LimiterBufferFullError %v, got %v", i+1, wantBufferFull[i], gotErr[i])
+		}
+	}
+	if err := limiter.SetCapacity(0); err == nil {
+		t.Errorf("BufferedLimiter.SetCapacity(0), want LimiterConfigError, got nil")
+	}
+}
+
+func TestBufferedSetRate(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewBufferedLimiter(3, 3, time.Second, WithClock(clock))
+	defer limiter.Close()
+	if _, err := limiter.TryWaitN(3); err != nil {
+		t.Fatalf("BufferedLimiter.TryWaitN(3), want nil, got %v", err)
+	}
+
+	gotErr := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, n := range []int{3, 1} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gotErr[i] = limiter.WaitN(context.Background(), n)
+		}()
+		for limiter.buffer.queuedPermits() != 3+i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// the request for 3 permits can never be granted at a rate of 2, the request for 1 is granted
+	// once the interval passes
+	if err := limiter.SetRate(2, time.Second); err != nil {
+		t.Errorf("BufferedLimiter.SetRate(2), want nil, got %v", err)
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	wg.Wait()
+
+	var tooLarge *LimiterRequestTooLargeError
+	if !errors.As(gotErr[0], &tooLarge) {
+		t.Errorf("BufferedLimiter.WaitN(3) after SetRate(2), want LimiterRequestTooLargeError, got %v", gotErr[0])
+	}
+	if gotErr[1] != nil {
+		t.Errorf("BufferedLimiter.WaitN(1) after SetRate(2), want nil, got %v", gotErr[1])
+	}
+}
+
+func TestBufferedWaitPriority(t *testing.T) {
+	type request struct {
+		name     string
+		priority int
+		after    time.Duration // the time advanced before the request is made
+	}
+	tests := []struct {
+		name      string
+		aging     time.Duration
+		requests  []request
+		wantOrder []string
+	}{
+		{
+			name: "Higher priority first, FIFO within a priority",
+			requests: []request{
+				{name: "a", priority: 0},
+				{name: "b", priority: 1},
+				{name: "c", priority: 2},
+				{name: "d", priority: 1},
+			},
+			wantOrder: []string{"c", "b", "d", "a"},
+		},
+		{
+			name: "Without aging",
+			requests: []request{
+				{name: "a", priority: 0},
+				{name: "b", priority: 3, after: time.Second * 5},
+			},
+			wantOrder: []string{"b", "a"},
+		},
+		{
+			name:  "Aging raises the priority of waiting requests",
+			aging: time.Second,
+			requests: []request{
+				{name: "a", priority: 0},
+				{name: "b", priority: 3, after: time.Second * 5},
+			},
+			wantOrder: []string{"a", "b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewBufferedLimiter(1, 10, time.Second*10, WithClock(clock), WithPriorityAging(tt.aging))
+			defer limiter.Close()
+			limiter.TryWait() // the requests wait for the next interval
+
+			granted := make(chan string, len(tt.requests))
+			var elapsed time.Duration
+			for i, r := range tt.requests {
+				clock.Advance(r.after)
+				elapsed += r.after
+				go func() {
+					if err := limiter.WaitPriority(context.Background(), r.priority); err != nil {
+						t.Errorf("BufferedLimiter.WaitPriority(%v), want nil, got %v", r.priority, err)
+					}
+					granted <- r.name
+				}()
+				for limiter.buffer.queuedPermits() != i+1 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			clock.Advance(time.Second*10 - elapsed)
+			for i, want := range tt.wantOrder {
+				if i > 0 {
+					clock.BlockUntil(1)
+					clock.Advance(time.Second * 10)
+				}
+				if got := <-granted; got != want {
+					t.Errorf("BufferedLimiter.WaitPriority() grant %v/%v, want %v, got %v", i+1, len(tt.wantOrder), want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestBufferedWaitFlow(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewBufferedLimiter(1, 2, time.Second, WithClock(clock), WithFairQueueing())
+	defer limiter.Close()
+	limiter.TryWait() // the requests wait for the next interval
+
+	granted := make(chan string, 4)
+	for i, name := range []string{"a1", "a2", "b1", "c1"} {
+		go func() {
+			if err := limiter.WaitFlow(context.Background(), name[:1]); err != nil {
+				t.Errorf("BufferedLimiter.WaitFlow(%v), want nil, got %v", name[:1], err)
+			}
+			granted <- name
+		}()
+		for limiter.buffer.queuedPermits() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	var bufferFull *LimiterBufferFullError
+	if err := limiter.WaitFlow(context.Background(), "a"); !errors.As(err, &bufferFull) {
+		t.Errorf("BufferedLimiter.WaitFlow(a) over the flow capacity, want LimiterBufferFullError, got %v", err)
+	}
+	if got := limiter.Stats().Capacity; got != 2 {
+		t.Errorf("BufferedLimiter.Stats().Capacity, want the flow capacity 2, got %v", got)
+	}
+
+	for i, want := range []string{"a1", "b1", "c1", "a2"} {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		if got := <-granted; got != want {
+			t.Errorf("BufferedLimiter.WaitFlow() grant %v/4, want %v, got %v", i+1, want, got)
+		}
+	}
+}
+
+func TestBufferedWaitFlowSetCapacity(t *testing.T) {
+	limiter := NewBufferedLimiter(1, 2, time.Minute, WithFairQueueing())
+	defer limiter.Close()
+	limiter.TryWait()
+
+	gotErr := make(chan error, 3)
+	for i, key := range []string{"a", "b", "a"} {
+		go func() {
+			gotErr <- limiter.WaitFlow(context.Background(), key)
+		}()
+		for limiter.buffer.queuedPermits() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// only the second request of flow a no longer fits
+	if err := limiter.SetCapacity(1); err != nil {
+		t.Fatalf("BufferedLimiter.SetCapacity(1), want nil, got %v", err)
+	}
+	var bufferFull *LimiterBufferFullError
+	if err := <-gotErr; !errors.As(err, &bufferFull) {
+		t.Errorf("BufferedLimiter.WaitFlow() after SetCapacity, want LimiterBufferFullError, got %v", err)
+	}
+	if got := limiter.Stats().Queued; got != 2 {
+		t.Errorf("BufferedLimiter.Stats().Queued after SetCapacity, want 2, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package rate
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time of the limiters.
+//
+// The limiters use the system clock by default. A different Clock can be passed to the
+// constructors with WithClock, for example the ManualClock of the ratetest package to control time
+// in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a channel that receives the current time once d has passed and a function
+	// that stops the timer, like time.NewTimer.
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+// the system clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	t := time.NewTimer(d)
+	return t.C, t.Stop
+}
+
+// returns a context that exceeds its deadline once the timeout passed on the clock
+//
+// the system clock uses context.WithTimeout, other clocks cancel the context with
+// context.DeadlineExceeded as the cause when their timer fires.
+func timeoutContext(clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(systemClock); ok {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	ctx, cancel := context.WithCancelCause(context.Background())
+	c, stop := clock.NewTimer(timeout)
+	go func() {
+		select {
+		case <-c:
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+			stop()
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// sleeps for d on the clock or until the context is done
+//
+// returns false if the context is done
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) bool {
+	c, stop := clock.NewTimer(d)
+	select {
+	case <-ctx.Done():
+		stop()
+		return false
+	case <-c:
+		return true
+	}
+}
@@ -0,0 +1,132 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+var _ Clock = (*ratetest.ManualClock)(nil)
+
+func TestUnbufferedManualClock(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewUnbufferedLimiter(2, time.Second, WithClock(clock))
+
+	for i := 0; i < 2; i++ {
+		if _, err := limiter.TryWait(); err != nil {
+			t.Errorf("UnbufferedLimiter.TryWait() %v/2, want nil, got %v", i+1, err)
+		}
+	}
+	if remaining, err := limiter.TryWait(); err == nil || remaining != time.Second {
+		t.Errorf("UnbufferedLimiter.TryWait() over limit, want remaining %v and an error, got %v, %v", time.Second, remaining, err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(nil)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second / 2)
+	select {
+	case err := <-done:
+		t.Errorf("UnbufferedLimiter.Wait() after half the interval, want blocked, got %v", err)
+	default:
+	}
+	clock.Advance(time.Second / 2)
+	if err := <-done; err != nil {
+		t.Errorf("UnbufferedLimiter.Wait() after the interval, want nil, got %v", err)
+	}
+}
+
+func TestUnbufferedManualClockTimeout(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewUnbufferedLimiter(1, time.Second, WithClock(clock))
+	if _, err := limiter.TryWait(); err != nil {
+		t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+	}
+
+	done := make(chan error)
+	timeout := time.Second / 2
+	go func() {
+		done <- limiter.Wait(&timeout)
+	}()
+	// the timeout timer and the timer waiting for the next permission
+	clock.BlockUntil(2)
+	clock.Advance(timeout)
+
+	err := <-done
+	var timedOut *LimiterWaitTimedOutError
+	if !errors.As(err, &timedOut) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UnbufferedLimiter.Wait(with timeout), want LimiterWaitTimedOutError wrapping context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestBufferedManualClock(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewBufferedLimiter(1, 5, time.Second, WithClock(clock))
+	defer limiter.Close()
+
+	granted := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			if err := limiter.Wait(nil); err != nil {
+				t.Errorf("BufferedLimiter.Wait() %v/3, want nil, got %v", i+1, err)
+			}
+			granted <- i
+		}()
+		// wait for the request to be granted or buffered before making the next one
+		if i == 0 {
+			<-granted
+			continue
+		}
+		for limiter.buffer.queuedPermits() != i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// the buffered requests are granted one per interval in the order they were made
+	for want := 1; want < 3; want++ {
+		// the approval loop waits on the clock for the next slot
+		clock.BlockUntil(1)
+		select {
+		case got := <-granted:
+			t.Errorf("BufferedLimiter.Wait() %v/3 before the interval, want blocked, got granted", got+1)
+		default:
+		}
+		clock.Advance(time.Second)
+		if got := <-granted; got != want {
+			t.Errorf("BufferedLimiter.Wait(), want request %v granted, got %v", want+1, got+1)
+		}
+	}
+}
+
+func TestIntervalOfZeroDefaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter Limiter
+	}{
+		{
+			name:    "UnbufferedLimiter",
+			limiter: NewUnbufferedLimiter(1, 0, WithClock(ratetest.NewManualClock(time.Now()))),
+		},
+		{
+			name:    "BufferedLimiter",
+			limiter: NewBufferedLimiter(1, 1, 0, WithClock(ratetest.NewManualClock(time.Now()))),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer tt.limiter.Close()
+			if _, err := tt.limiter.TryWait(); err != nil {
+				t.Errorf("Limiter.TryWait(), want nil, got %v", err)
+			}
+			if remaining, _ := tt.limiter.TryWait(); remaining != time.Millisecond {
+				t.Errorf("Limiter.TryWait(), want remaining %v, got %v", time.Millisecond, remaining)
+			}
+		})
+	}
+}
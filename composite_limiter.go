@@ -0,0 +1,179 @@
+package rate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// atomicLimiter is implemented by the limiters that can check whether permits can be granted and
+// record them separately while holding their lock, so a CompositeLimiter only records the permits
+// when all of its limiters allow them
+type atomicLimiter interface {
+	Limiter
+	lock()
+	unlock()
+	checkN(n int) (time.Duration, error)
+	commitN(n int)
+}
+
+var (
+	_ atomicLimiter = (*UnbufferedLimiter)(nil)
+	_ atomicLimiter = (*TokenBucketLimiter)(nil)
+	_ atomicLimiter = (*LeakyBucketLimiter)(nil)
+	_ atomicLimiter = (*FixedWindowLimiter)(nil)
+	_ atomicLimiter = (*SlidingWindowLimiter)(nil)
+	_ atomicLimiter = (*AdaptiveLimiter)(nil)
+)
+
+// A CompositeLimiter is a limiter without an internal buffer that grants permission only when all
+// of its limiters do, enforcing several limits at once such as a rate per second, per minute and
+// per day
+type CompositeLimiter struct {
+	mu       *sync.Mutex
+	limiters []atomicLimiter
+	clock    Clock
+	closed   bool
+}
+
+// NewCompositeLimiter returns a new CompositeLimiter given the limiters it combines.
+//
+// The CompositeLimiter checks all of its limiters while holding all their locks and only records
+// the permits in every limiter when all of them allow them, so a limit that denies a request does
+// not use up the permits of the others. The limiters can be UnbufferedLimiters, TokenBucketLimiters,
+// LeakyBucketLimiters, FixedWindowLimiters, SlidingWindowLimiters or AdaptiveLimiters, and can still
+// be used on their own or in other CompositeLimiters.
+//
+// A LimiterConfig error is returned if there are no limiters, a limiter is not one of those types
+// or the same limiter is received more than once.
+//
+// The options configure the rest of the CompositeLimiter, such as the clock it uses to wait, which
+// should be the clock of its limiters.
+func NewCompositeLimiter(limiters []Limiter, opts ...Option) (*CompositeLimiter, error) {
+	o := newOptions(opts)
+	if len(limiters) == 0 {
+		return nil, newConfigError("limiters", len(limiters))
+	}
+	atomics := make([]atomicLimiter, 0, len(limiters))
+	seen := make(map[atomicLimiter]bool, len(limiters))
+	for _, limiter := range limiters {
+		a, ok := limiter.(atomicLimiter)
+		if !ok {
+			return nil, &LimiterConfigError{message: fmt.Sprintf("invalid configuration: %T can't be combined", limiter)}
+		}
+		if seen[a] {
+			return nil, &LimiterConfigError{message: "invalid configuration: the same limiter can't be combined twice"}
+		}
+		seen[a] = true
+		atomics = append(atomics, a)
+	}
+	// always lock the limiters in the same order so CompositeLimiters sharing limiters don't deadlock
+	sort.Slice(atomics, func(i, j int) bool {
+		return reflect.ValueOf(atomics[i]).Pointer() < reflect.ValueOf(atomics[j]).Pointer()
+	})
+	return &CompositeLimiter{
+		mu:       &sync.Mutex{},
+		limiters: atomics,
+		clock:    o.clock,
+		closed:   false,
+	}, nil
+}
+
+// Wait returns when all the limiters grant permission or the request times out.
+//
+// The Wait receiver on the CompositeLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// CompositeLimiter will grant permission.
+func (l *CompositeLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when all the limiters grant permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned.
+func (l *CompositeLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// If n is greater than what one of the limiters could ever grant a LimiterRequestTooLarge error is
+// returned, and if n <= 0 WaitN returns nil immediately.
+func (l *CompositeLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, l.TryWaitN)
+}
+
+// TryWait returns whether or not all the limiters granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
+// is nil and a permit is recorded in every limiter. Otherwise nothing is recorded and the error of
+// the limiter that denied permission is returned, for LimiterOverLimit errors the longest time
+// duration until all the limiters could grant permission. Once the CompositeLimiter or one of its
+// limiters is closed a LimiterClosed error is returned.
+func (l *CompositeLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once from every limiter.
+func (l *CompositeLimiter) TryWaitN(n int) (time.Duration, error) {
+	l.mu.Lock()
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		return 0, newClosedError()
+	}
+	for _, limiter := range l.limiters {
+		limiter.lock()
+		defer limiter.unlock()
+	}
+	var longest time.Duration
+	var overLimit error
+	for _, limiter := range l.limiters {
+		remaining, err := limiter.checkN(n)
+		if err == nil {
+			continue
+		}
+		if _, ok := err.(*LimiterOverLimitError); !ok {
+			return 0, err
+		}
+		// the error of the longest wait is returned so its RetryAfter matches the remaining time
+		if overLimit == nil || remaining > longest {
+			overLimit = err
+			longest = remaining
+		}
+	}
+	if overLimit != nil {
+		return longest, overLimit
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	for _, limiter := range l.limiters {
+		limiter.commitN(n)
+	}
+	return 0, nil
+}
+
+// Close closes the CompositeLimiter.
+//
+// Close only marks the CompositeLimiter as closed, all subsequent calls to Wait and TryWait return a
+// LimiterClosed error. Its limiters are not closed since they may be used elsewhere. Calling Close
+// more than once has no effect and the returned error is always nil.
+func (l *CompositeLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,115 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestCompositeLimiterTryWait(t *testing.T) {
+	// start at the beginning of a window so advancing a second never crosses into the next one
+	clock := ratetest.NewManualClock(time.Now().Truncate(time.Second * 10))
+	perSecond := NewUnbufferedLimiter(2, time.Second, WithClock(clock))
+	perTenSeconds := NewFixedWindowLimiter(3, time.Second*10, WithClock(clock))
+	limiter, err := NewCompositeLimiter([]Limiter{perSecond, perTenSeconds}, WithClock(clock))
+	if err != nil {
+		t.Fatalf("NewCompositeLimiter(), want nil, got %v", err)
+	}
+	windowEnd := clock.Now().Truncate(time.Second * 10).Add(time.Second * 10)
+
+	tests := []struct {
+		name          string
+		advance       time.Duration
+		n             int
+		wantErr       bool
+		wantRemaining time.Duration
+	}{
+		{name: "Both allow", n: 2, wantErr: false},
+		{name: "Per second denies", n: 1, wantErr: true, wantRemaining: time.Second},
+		{name: "Both allow after a second", advance: time.Second, n: 1, wantErr: false},
+		{name: "Per ten seconds denies", n: 1, wantErr: true, wantRemaining: windowEnd.Sub(clock.Now().Add(time.Second))},
+		{name: "Request too large", n: 3, wantErr: true, wantRemaining: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			remaining, err := limiter.TryWaitN(tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CompositeLimiter.TryWaitN(%v), wantErr %v, got %v", tt.n, tt.wantErr, err)
+			}
+			if remaining != tt.wantRemaining {
+				t.Errorf("CompositeLimiter.TryWaitN(%v) remaining, want %v, got %v", tt.n, tt.wantRemaining, remaining)
+			}
+		})
+	}
+
+	// the denied requests did not use up permits of the limiters that allowed them
+	if _, err := perSecond.TryWait(); err != nil {
+		t.Errorf("UnbufferedLimiter.TryWait() after the composite was denied, want nil, got %v", err)
+	}
+}
+
+func TestCompositeLimiterWaitN(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	first := NewUnbufferedLimiter(1, time.Second, WithClock(clock))
+	second := NewTokenBucketLimiter(1, 1, time.Second*2, WithClock(clock))
+	limiter, _ := NewCompositeLimiter([]Limiter{first, second}, WithClock(clock))
+	limiter.TryWait()
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.WaitContext(context.Background())
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("CompositeLimiter.WaitContext() before the longest limit, want blocked, got %v", err)
+	default:
+	}
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Errorf("CompositeLimiter.WaitContext(), want nil, got %v", err)
+	}
+
+	limiter.Close()
+	var closed *LimiterClosedError
+	if _, err := limiter.TryWait(); !errors.As(err, &closed) {
+		t.Errorf("CompositeLimiter.TryWait() after Close, want LimiterClosedError, got %v", err)
+	}
+	if _, err := first.TryWait(); errors.As(err, &closed) {
+		t.Errorf("UnbufferedLimiter.TryWait() after the composite was closed, want it still open, got %v", err)
+	}
+}
+
+func TestNewCompositeLimiter(t *testing.T) {
+	unbuffered := NewUnbufferedLimiter(1, time.Second)
+	buffered := NewBufferedLimiter(1, 1, time.Second)
+	defer buffered.Close()
+
+	tests := []struct {
+		name     string
+		limiters []Limiter
+		wantErr  bool
+	}{
+		{name: "Supported limiters", limiters: []Limiter{unbuffered, NewSlidingWindowLimiter(1, time.Second)}, wantErr: false},
+		{name: "No limiters", limiters: nil, wantErr: true},
+		{name: "Unsupported limiter", limiters: []Limiter{unbuffered, buffered}, wantErr: true},
+		{name: "Same limiter twice", limiters: []Limiter{unbuffered, unbuffered}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCompositeLimiter(tt.limiters)
+			var configErr *LimiterConfigError
+			if gotErr := errors.As(err, &configErr); gotErr != tt.wantErr {
+				t.Errorf("NewCompositeLimiter(), wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
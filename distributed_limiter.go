@@ -0,0 +1,166 @@
+package rate
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A DistributedLimiter is a limiter without an internal buffer that shares the permissions it
+// grants with every DistributedLimiter using the same store and key, so the rate is enforced
+// across processes
+type DistributedLimiter struct {
+	mu       *sync.Mutex
+	store    Store
+	key      string
+	rate     int
+	interval time.Duration
+	clock    Clock
+	closed   bool
+}
+
+// NewDistributedLimiter returns a new DistributedLimiter given a store, the key of the limit in
+// the store, a rate and a time interval.
+//
+// The DistributedLimiter works like the SlidingWindowLimiter with the counts of the windows kept
+// in the store, under the key followed by the number of the window, so it enforces the rate
+// closely but not exactly. The windows are aligned to the clock so the clocks of the processes
+// sharing the limit must be in sync, a skew between them changes the permissions granted by the
+// same fraction of the interval. Every request takes a few round trips to the store, when it is
+// unavailable the requests return the error of the store.
+//
+// If the rate received <= 0 the rate will default to 1 and if the interval received <= 0 it will
+// be set to 1 millisecond. This is to prevent the DistributedLimiter from erroring during use
+// without the NewDistributedLimiter function returning an error.
+//
+// The options configure the rest of the DistributedLimiter, such as the clock it uses.
+func NewDistributedLimiter(store Store, key string, rate int, interval time.Duration, opts ...Option) *DistributedLimiter {
+	o := newOptions(opts)
+	o.rate = rate
+	o.interval = interval
+	o.lenient()
+	return &DistributedLimiter{
+		mu:       &sync.Mutex{},
+		store:    store,
+		key:      key,
+		rate:     o.rate,
+		interval: o.interval,
+		clock:    o.clock,
+		closed:   false,
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// The Wait receiver on the DistributedLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned. An error from the store is returned as is.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// DistributedLimiter will grant permission, within a process or across processes.
+func (l *DistributedLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned. The context is also passed to the store.
+func (l *DistributedLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// If n is greater than the rate a LimiterRequestTooLarge error is returned, and if n <= 0 WaitN
+// returns nil immediately.
+func (l *DistributedLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, func(n int) (time.Duration, error) {
+		return l.tryWaitN(ctx, n)
+	})
+}
+
+// TryWait returns whether or not the DistributedLimiter granted permission.
+//
+// The TryWait receiver returns without waiting for permission. If permission is granted the error
+// is nil. If permission is not granted a LimiterOverLimit error is returned and the estimated time
+// duration until permission can be granted. Once the limiter is closed a LimiterClosed error is
+// returned.
+func (l *DistributedLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned, and if n <= 0 nothing is granted and the error is nil.
+func (l *DistributedLimiter) TryWaitN(n int) (time.Duration, error) {
+	return l.tryWaitN(context.Background(), n)
+}
+
+// tries to grant n permits using the context for the requests to the store
+func (l *DistributedLimiter) tryWaitN(ctx context.Context, n int) (time.Duration, error) {
+	l.mu.Lock()
+	closed := l.closed
+	l.mu.Unlock()
+	if closed {
+		return 0, newClosedError()
+	}
+	if n > l.rate {
+		return 0, newRequestTooLargeError(l.rate)
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	now := l.clock.Now()
+	window := now.UnixNano() / int64(l.interval)
+	elapsed := now.Sub(time.Unix(0, window*int64(l.interval)))
+	// a window is the previous window during the next interval so it must live until its end
+	ttl := 2*l.interval - elapsed
+	previous, err := l.store.Increment(ctx, l.windowKey(window-1), 0, ttl)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		current, err := l.store.Increment(ctx, l.windowKey(window), 0, ttl)
+		if err != nil {
+			return 0, err
+		}
+		if slidingEstimate(int(previous), int(current), l.interval, elapsed)+float64(n) > float64(l.rate) {
+			remaining := slidingRemaining(l.rate, int(previous), int(current), n, l.interval, elapsed)
+			return remaining, newOverLimitError(remaining, l.rate)
+		}
+		// only count the permits if no other limiter granted permits since the count was read,
+		// otherwise read it again
+		ok, err := l.store.CompareAndSwap(ctx, l.windowKey(window), current, current+int64(n), ttl)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			return 0, nil
+		}
+	}
+}
+
+// returns the key of the window in the store
+func (l *DistributedLimiter) windowKey(window int64) string {
+	return l.key + ":" + strconv.FormatInt(window, 10)
+}
+
+// Close closes the DistributedLimiter.
+//
+// Close only marks this limiter as closed, all subsequent calls to Wait and TryWait return a
+// LimiterClosed error. The store is not closed and the other limiters sharing the key are not
+// affected. Calling Close more than once has no effect and the returned error is always nil.
+func (l *DistributedLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,100 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestDistributedLimiterShared(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore(WithClock(clock))
+	replicas := []*DistributedLimiter{
+		NewDistributedLimiter(store, "api", 4, time.Second, WithClock(clock)),
+		NewDistributedLimiter(store, "api", 4, time.Second, WithClock(clock)),
+	}
+	other := NewDistributedLimiter(store, "other", 4, time.Second, WithClock(clock))
+
+	granted := 0
+	for i := 0; i < 8; i++ {
+		if _, err := replicas[i%2].TryWait(); err == nil {
+			granted++
+		}
+	}
+	if granted != 4 {
+		t.Errorf("DistributedLimiter.TryWait() granted across replicas, want 4, got %v", granted)
+	}
+	if _, err := other.TryWait(); err != nil {
+		t.Errorf("DistributedLimiter.TryWait() other key, want nil, got %v", err)
+	}
+
+	// half way through the next window half of the previous window still counts
+	clock.Advance(time.Millisecond * 1500)
+	remaining, err := replicas[0].TryWaitN(3)
+	var overLimit *LimiterOverLimitError
+	if !errors.As(err, &overLimit) || remaining <= 0 {
+		t.Errorf("DistributedLimiter.TryWaitN(3) half way through the next window, want LimiterOverLimitError and remaining > 0, got %v %v", remaining, err)
+	}
+	if _, err := replicas[1].TryWaitN(2); err != nil {
+		t.Errorf("DistributedLimiter.TryWaitN(2) half way through the next window, want nil, got %v", err)
+	}
+	clock.Advance(remaining)
+	if _, err := replicas[0].TryWait(); err != nil {
+		t.Errorf("DistributedLimiter.TryWait() after the remaining duration, want nil, got %v", err)
+	}
+}
+
+func TestDistributedLimiterConcurrent(t *testing.T) {
+	store := NewMemoryStore()
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		limiter := NewDistributedLimiter(store, "api", 10, time.Minute)
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := limiter.TryWait(); err == nil {
+					granted.Add(1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if got := granted.Load(); got != 10 {
+		t.Errorf("DistributedLimiter.TryWait() granted concurrently, want 10, got %v", got)
+	}
+}
+
+// a store that always fails
+type failingStore struct{}
+
+var errStore = errors.New("store unavailable")
+
+func (failingStore) Increment(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	return 0, errStore
+}
+
+func (failingStore) CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	return false, errStore
+}
+
+func TestDistributedLimiterErrors(t *testing.T) {
+	limiter := NewDistributedLimiter(failingStore{}, "api", 1, time.Second)
+	if err := limiter.WaitContext(context.Background()); !errors.Is(err, errStore) {
+		t.Errorf("DistributedLimiter.WaitContext() with a failing store, want the store error, got %v", err)
+	}
+	if _, err := limiter.TryWaitN(2); err == nil {
+		t.Errorf("DistributedLimiter.TryWaitN(2), want LimiterRequestTooLargeError, got nil")
+	}
+	limiter.Close()
+	var closed *LimiterClosedError
+	if _, err := limiter.TryWait(); !errors.As(err, &closed) {
+		t.Errorf("DistributedLimiter.TryWait() after Close, want LimiterClosedError, got %v", err)
+	}
+}
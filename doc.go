@@ -3,6 +3,40 @@
 //
 // The package contains two types of limiters the buffered limiter and the unbuffered limiter. The
 // buffered limiter has an internal buffer that ensures that concurrent requests for permissions are
-// granted in the order that they were received by the limiter. The unbuffered limiter also has a
+// granted in the order that they were received by the limiter. Both limiters also have a
 // non-blocking option.
+//
+// The unbuffered limiter can also reserve permits ahead of time, the reservation tells how long to
+// wait before acting and can be canceled to give the permits back when they turn out not to be
+// needed.
+//
+// The state of the buffered and unbuffered limiters can be encoded and restored, and checkpointed to
+// a file, so the recent grants are still enforced after a restart.
+//
+// The token bucket limiter is an alternative to the unbuffered limiter that allows bursts above the
+// sustained rate and uses the same amount of memory regardless of the rate. The leaky bucket limiter
+// does the opposite and spaces permissions evenly over the interval to smooth out bursts.
+//
+// The buffered and unbuffered limiters remember the time of every permission granted in the last
+// interval, which enforces the rate exactly but uses memory proportional to the rate. For very high
+// rates the fixed window and sliding window limiters only keep counts, trading some accuracy for
+// constant memory.
+//
+// The adaptive limiter adjusts its rate to the feedback it receives about the limited operations,
+// for use when the limit of a service is not known in advance or changes.
+//
+// The distributed limiter shares its limit between processes through a Store, such as a Redis
+// server using the rateredis package, so the rate is enforced across all the replicas of a service.
+//
+// The composite limiter combines several limiters, granting permission only when all of them do
+// without using up the permits of the others when one of them denies it.
+//
+// The keyed limiter keeps a separate limiter per key, for example per client, creating them on
+// first use and evicting them once idle.
+//
+// The errors returned by the limiters match the sentinel errors, such as ErrOverLimit, with
+// errors.Is and carry the details of the denial, such as when to retry, in exported fields.
+//
+// All limiters implement the Limiter interface so code that waits for permission can be written
+// once and the limiting strategy chosen at run time.
 package rate
@@ -1,16 +1,58 @@
 package rate
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// The sentinel errors match the errors of the same kind returned by the limiters with errors.Is, so
+// callers several layers up can tell why a permission was denied without knowing the error types.
+// Use errors.As with the error types to read their fields.
+var (
+	// ErrWaitTimedOut matches a LimiterWaitTimedOutError
+	ErrWaitTimedOut = errors.New("permission denied: timed out")
+	// ErrOverLimit matches a LimiterOverLimitError
+	ErrOverLimit = errors.New("permission denied: limit reached")
+	// ErrBufferFull matches a LimiterBufferFullError
+	ErrBufferFull = errors.New("permission denied: buffer full")
+	// ErrClosed matches a LimiterClosedError
+	ErrClosed = errors.New("permission denied: limiter closed")
+	// ErrRequestTooLarge matches a LimiterRequestTooLargeError
+	ErrRequestTooLarge = errors.New("permission denied: request exceeds rate")
+	// ErrConfig matches a LimiterConfigError
+	ErrConfig = errors.New("invalid configuration")
+)
+
 // LimiterWaitTimedOutError is the error returned when limiter.Wait times out
 type LimiterWaitTimedOutError struct {
+	// Waited is how long the request waited for permission before timing out
+	Waited  time.Duration
 	message string
+	err     error
 }
 
 func (l *LimiterWaitTimedOutError) Error() string {
 	return l.message
 }
 
+// Unwrap returns the context error that caused the time out, if any
+func (l *LimiterWaitTimedOutError) Unwrap() error {
+	return l.err
+}
+
+// Is reports whether the target is ErrWaitTimedOut
+func (l *LimiterWaitTimedOutError) Is(target error) bool {
+	return target == ErrWaitTimedOut
+}
+
 // LimiterOverLimitError is the error returned when the unbufferedlimiter.TryWait fails
 type LimiterOverLimitError struct {
+	// RetryAfter is the time remaining until the permits can be granted, the same duration TryWait
+	// returns
+	RetryAfter time.Duration
+	// Limit is the number of permits the limiter grants per interval
+	Limit   int
 	message string
 }
 
@@ -18,11 +60,97 @@ func (l *LimiterOverLimitError) Error() string {
 	return l.message
 }
 
+// Is reports whether the target is ErrOverLimit
+func (l *LimiterOverLimitError) Is(target error) bool {
+	return target == ErrOverLimit
+}
+
 // LimiterBufferFullError is the error returned when the buffer of the bufferedlimiter is full
 type LimiterBufferFullError struct {
-	message string
+	// QueueDepth is the number of requests that were waiting in the buffer when the request was
+	// denied
+	QueueDepth int
+	message    string
 }
 
 func (l *LimiterBufferFullError) Error() string {
 	return l.message
 }
+
+// Is reports whether the target is ErrBufferFull
+func (l *LimiterBufferFullError) Is(target error) bool {
+	return target == ErrBufferFull
+}
+
+// LimiterClosedError is the error returned when the limiter was closed
+type LimiterClosedError struct {
+	message string
+}
+
+func (l *LimiterClosedError) Error() string {
+	return l.message
+}
+
+// Is reports whether the target is ErrClosed
+func (l *LimiterClosedError) Is(target error) bool {
+	return target == ErrClosed
+}
+
+// LimiterRequestTooLargeError is the error returned when more permits are requested at once than
+// the limiter can ever grant
+type LimiterRequestTooLargeError struct {
+	// Limit is the largest number of permits the limiter can grant at once
+	Limit   int
+	message string
+}
+
+func (l *LimiterRequestTooLargeError) Error() string {
+	return l.message
+}
+
+// Is reports whether the target is ErrRequestTooLarge
+func (l *LimiterRequestTooLargeError) Is(target error) bool {
+	return target == ErrRequestTooLarge
+}
+
+// LimiterConfigError is the error returned when a limiter is created with an invalid configuration
+type LimiterConfigError struct {
+	message string
+}
+
+func (l *LimiterConfigError) Error() string {
+	return l.message
+}
+
+// Is reports whether the target is ErrConfig
+func (l *LimiterConfigError) Is(target error) bool {
+	return target == ErrConfig
+}
+
+func newOverLimitError(retryAfter time.Duration, limit int) error {
+	return &LimiterOverLimitError{RetryAfter: retryAfter, Limit: limit, message: "permission denied: limit reached"}
+}
+
+func newBufferFullError(queueDepth int) error {
+	return &LimiterBufferFullError{QueueDepth: queueDepth, message: "permission denied: buffer full"}
+}
+
+func newClosedError() error {
+	return &LimiterClosedError{message: "permission denied: limiter closed"}
+}
+
+func newRequestTooLargeError(limit int) error {
+	return &LimiterRequestTooLargeError{Limit: limit, message: "permission denied: request exceeds rate"}
+}
+
+// returns the error for a context that is done after waiting for the given duration. A context that
+// exceeded its deadline, or was cancelled because a clock timeout passed, is reported as a
+// LimiterWaitTimedOutError wrapping context.DeadlineExceeded, any other context error is returned as
+// is.
+func contextError(ctx context.Context, waited time.Duration) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(context.Cause(ctx), context.DeadlineExceeded) {
+		return &LimiterWaitTimedOutError{Waited: waited, message: "permission denied: timed out", err: context.DeadlineExceeded}
+	}
+	return err
+}
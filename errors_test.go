@@ -0,0 +1,83 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestErrorsIs(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		sentinel error
+	}{
+		{name: "Wait timed out", err: &LimiterWaitTimedOutError{}, sentinel: ErrWaitTimedOut},
+		{name: "Over limit", err: &LimiterOverLimitError{}, sentinel: ErrOverLimit},
+		{name: "Buffer full", err: &LimiterBufferFullError{}, sentinel: ErrBufferFull},
+		{name: "Closed", err: &LimiterClosedError{}, sentinel: ErrClosed},
+		{name: "Request too large", err: &LimiterRequestTooLargeError{}, sentinel: ErrRequestTooLarge},
+		{name: "Config", err: &LimiterConfigError{}, sentinel: ErrConfig},
+	}
+
+	sentinels := []error{ErrWaitTimedOut, ErrOverLimit, ErrBufferFull, ErrClosed, ErrRequestTooLarge, ErrConfig}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, sentinel := range sentinels {
+				want := sentinel == tt.sentinel
+				if got := errors.Is(tt.err, sentinel); got != want {
+					t.Errorf("errors.Is(%T, %v), want %v, got %v", tt.err, sentinel, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+
+	unbuffered := NewUnbufferedLimiter(2, time.Second, WithClock(clock))
+	unbuffered.TryWaitN(2)
+	clock.Advance(time.Millisecond * 400)
+	remaining, err := unbuffered.TryWait()
+	var overLimit *LimiterOverLimitError
+	if !errors.As(err, &overLimit) {
+		t.Fatalf("UnbufferedLimiter.TryWait(), want LimiterOverLimitError, got %v", err)
+	}
+	if overLimit.RetryAfter != remaining || overLimit.Limit != 2 {
+		t.Errorf("LimiterOverLimitError, want RetryAfter %v and Limit 2, got %v and %v", remaining, overLimit.RetryAfter, overLimit.Limit)
+	}
+
+	_, err = unbuffered.TryWaitN(3)
+	var tooLarge *LimiterRequestTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 2 {
+		t.Errorf("UnbufferedLimiter.TryWaitN(3), want LimiterRequestTooLargeError with Limit 2, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	limiter := NewUnbufferedLimiter(1, time.Hour)
+	limiter.TryWait()
+	err = limiter.WaitN(ctx, 1)
+	var timedOut *LimiterWaitTimedOutError
+	if !errors.As(err, &timedOut) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UnbufferedLimiter.WaitN() past the deadline, want LimiterWaitTimedOutError wrapping context.DeadlineExceeded, got %v", err)
+	}
+	if timedOut.Waited <= 0 {
+		t.Errorf("LimiterWaitTimedOutError.Waited, want > 0, got %v", timedOut.Waited)
+	}
+
+	buffered := NewBufferedLimiter(1, 1, time.Hour, WithClock(clock))
+	defer buffered.Close()
+	buffered.Wait(nil)
+	go buffered.Wait(nil)
+	clock.BlockUntil(1)
+	err = buffered.Wait(nil)
+	var bufferFull *LimiterBufferFullError
+	if !errors.As(err, &bufferFull) || bufferFull.QueueDepth != 1 {
+		t.Errorf("BufferedLimiter.Wait() with a full buffer, want LimiterBufferFullError with QueueDepth 1, got %v", err)
+	}
+}
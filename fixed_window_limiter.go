@@ -0,0 +1,158 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A FixedWindowLimiter is a limiter without an internal buffer that counts the permissions granted
+// in fixed time windows
+type FixedWindowLimiter struct {
+	mu          *sync.Mutex
+	rate        int
+	interval    time.Duration
+	windowStart time.Time
+	count       int
+	clock       Clock
+	closed      bool
+}
+
+// NewFixedWindowLimiter returns a new FixedWindowLimiter given a rate and a time interval.
+//
+// The FixedWindowLimiter divides time into windows the length of the interval and grants up to rate
+// permissions in each window. It only keeps a count of the permissions granted in the current
+// window, so unlike the UnbufferedLimiter, which keeps the time of every permission granted in the
+// last interval, its memory usage does not depend on the rate. This makes it suitable for very
+// high rates.
+//
+// The trade-off is accuracy, since the count resets at the start of every window up to twice the
+// rate can be granted in an interval that spans the end of one window and the start of the next.
+// Use the SlidingWindowLimiter for a closer approximation or the UnbufferedLimiter when the rate
+// must be enforced exactly.
+//
+// If the rate received <= 0 the rate will default to 1 and if the interval received <= 0 it will
+// be set to 1 millisecond. This is to prevent the FixedWindowLimiter from erroring during use
+// without the NewFixedWindowLimiter function returning an error.
+//
+// The options configure the rest of the FixedWindowLimiter, such as the clock it uses.
+func NewFixedWindowLimiter(rate int, interval time.Duration, opts ...Option) *FixedWindowLimiter {
+	o := newOptions(opts)
+	if rate <= 0 {
+		rate = 1
+	}
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return &FixedWindowLimiter{
+		mu:          &sync.Mutex{},
+		rate:        rate,
+		interval:    interval,
+		windowStart: time.Time{},
+		count:       0,
+		clock:       o.clock,
+		closed:      false,
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// The Wait receiver on the FixedWindowLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// FixedWindowLimiter will grant permission.
+func (l *FixedWindowLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned.
+func (l *FixedWindowLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// If n is greater than the rate a LimiterRequestTooLarge error is returned, and if n <= 0 WaitN
+// returns nil immediately.
+func (l *FixedWindowLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, l.TryWaitN)
+}
+
+// TryWait returns whether or not the FixedWindowLimiter granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
+// is nil. If permission is not granted a LimiterOverLimit error is returned and the time duration
+// until the next window starts. Once the limiter is closed a LimiterClosed error is returned.
+func (l *FixedWindowLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned, and if n <= 0 nothing is granted and the error is nil.
+func (l *FixedWindowLimiter) TryWaitN(n int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	remaining, err := l.checkN(n)
+	if err != nil || n <= 0 {
+		return remaining, err
+	}
+	l.commitN(n)
+	return 0, nil
+}
+
+func (l *FixedWindowLimiter) lock()   { l.mu.Lock() }
+func (l *FixedWindowLimiter) unlock() { l.mu.Unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *FixedWindowLimiter) checkN(n int) (time.Duration, error) {
+	if l.closed {
+		return 0, newClosedError()
+	}
+	if n > l.rate {
+		return 0, newRequestTooLargeError(l.rate)
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	now := l.clock.Now()
+	if windowEnd := l.windowStart.Add(l.interval); !now.Before(windowEnd) { // start a new window
+		l.windowStart = now.Truncate(l.interval)
+		l.count = 0
+	}
+	if l.count+n <= l.rate {
+		return 0, nil
+	}
+	remaining := l.windowStart.Add(l.interval).Sub(now)
+	return remaining, newOverLimitError(remaining, l.rate)
+}
+
+// counts n permits in the current window. Must be called while holding the lock after checkN
+// allowed them.
+func (l *FixedWindowLimiter) commitN(n int) {
+	l.count += n
+}
+
+// Close closes the FixedWindowLimiter.
+//
+// The FixedWindowLimiter holds no resources so Close only marks the limiter as closed, all
+// subsequent calls to Wait and TryWait return a LimiterClosed error. Calling Close more than once
+// has no effect and the returned error is always nil.
+func (l *FixedWindowLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,67 @@
+package rate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedWindowWait(t *testing.T) {
+	tests := []struct {
+		name        string
+		limiter     *FixedWindowLimiter
+		count       int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "Within limit",
+			limiter:     NewFixedWindowLimiter(5, time.Second),
+			count:       5,
+			minDuration: 0,
+			maxDuration: time.Second,
+		},
+		{
+			name:        "7 requests at 3 per second",
+			limiter:     NewFixedWindowLimiter(3, time.Second),
+			count:       7,
+			minDuration: time.Second,
+			maxDuration: time.Second * 3,
+		},
+		{
+			name:        "High rate",
+			limiter:     NewFixedWindowLimiter(1_000_000, time.Minute),
+			count:       10_000,
+			minDuration: 0,
+			maxDuration: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			for i := 0; i < tt.count; i++ {
+				if gotErr := tt.limiter.Wait(nil); gotErr != nil {
+					t.Errorf("FixedWindowLimiter.Wait() %v/%v, want nil, got %v", i+1, tt.count, gotErr)
+				}
+			}
+			gotDuration := time.Since(start)
+			if gotDuration < tt.minDuration || gotDuration > tt.maxDuration {
+				t.Errorf("FixedWindowLimiter.Wait(), wantDuration in range (%v, %v) got %v", tt.minDuration, tt.maxDuration, gotDuration)
+			}
+		})
+	}
+}
+
+func TestFixedWindowTryWait(t *testing.T) {
+	limiter := NewFixedWindowLimiter(2, time.Second)
+	wantErr := []bool{false, false, true}
+	for i, want := range wantErr {
+		gotRemaining, gotErr := limiter.TryWait()
+		if (gotErr != nil) != want {
+			t.Errorf("FixedWindowLimiter.TryWait() %v/%v, wantErr %v, got %v", i+1, len(wantErr), want, gotErr)
+		}
+		if gotRemaining < 0 || gotRemaining > time.Second || (gotRemaining > 0) != want {
+			t.Errorf("FixedWindowLimiter.TryWait() %v/%v, wantRemaining in range (0, %v), got %v", i+1, len(wantErr), time.Second, gotRemaining)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package rate
+
+import (
+	"container/list"
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// the number of shards the keys of a KeyedLimiter are spread over to reduce lock contention
+const keyedShards = 32
+
+// A KeyedLimiter is a set of limiters, one per key, that are created when a key is first used and
+// evicted once the key is idle
+type KeyedLimiter struct {
+	factory   func(key string) Limiter
+	ttl       time.Duration
+	maxKeys   int
+	keys      *atomic.Int64
+	clock     Clock
+	shards    []*keyedShard
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// a shard of the keys of a KeyedLimiter with its own lock, the keys are kept in the order they
+// were last used with the most recently used at the front
+type keyedShard struct {
+	mu      *sync.Mutex
+	keys    *atomic.Int64 // the number of keys of all the shards
+	entries map[string]*list.Element
+	lru     *list.List
+	closed  bool
+}
+
+// the limiter of a single key
+type keyedEntry struct {
+	key      string
+	limiter  Limiter
+	lastUsed time.Time
+	active   int
+}
+
+// NewKeyedLimiter returns a new KeyedLimiter given a factory, an idle time to live and a maximum
+// number of keys.
+//
+// The KeyedLimiter calls the factory to create the limiter of a key the first time the key is used,
+// for example to limit every client by its API key or IP address.
+//
+//	limiter := rate.NewKeyedLimiter(func(key string) rate.Limiter {
+//		return rate.NewUnbufferedLimiter(10, time.Second)
+//	}, time.Minute*10, 100_000)
+//
+// A key that was not used for the ttl is evicted and its limiter closed, which for a BufferedLimiter
+// stops its goroutine. If the ttl <= 0 keys are never evicted for being idle. When there are more
+// than maxKeys keys the least recently used keys are evicted, if maxKeys <= 0 the number of keys is
+// not bounded. A key with a request waiting through the KeyedLimiter is never evicted, so while
+// more than maxKeys keys have requests waiting the bound is exceeded until the requests return.
+//
+// The KeyedLimiter runs a goroutine to evict idle keys when the ttl > 0, call Close when the
+// KeyedLimiter is no longer needed to release it.
+//
+// The options configure the rest of the KeyedLimiter, such as the clock it uses to tell when keys
+// are idle. They are not passed to the factory.
+func NewKeyedLimiter(factory func(key string) Limiter, ttl time.Duration, maxKeys int, opts ...Option) *KeyedLimiter {
+	o := newOptions(opts)
+	l := &KeyedLimiter{
+		factory:   factory,
+		ttl:       ttl,
+		maxKeys:   maxKeys,
+		keys:      &atomic.Int64{},
+		clock:     o.clock,
+		shards:    make([]*keyedShard, keyedShards),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+	for i := range l.shards {
+		l.shards[i] = &keyedShard{
+			mu:      &sync.Mutex{},
+			keys:    l.keys,
+			entries: make(map[string]*list.Element),
+			lru:     list.New(),
+			closed:  false,
+		}
+	}
+	if ttl > 0 {
+		go l.evictionLoop()
+	}
+	return l
+}
+
+// Get returns the limiter of the key, creating it if needed.
+//
+// The returned limiter is closed when the key is evicted, requests made through it after that
+// return a LimiterClosedError. Prefer the Wait methods of the KeyedLimiter which keep the key from
+// being evicted while the request is waiting. Once the KeyedLimiter is closed Get returns nil.
+func (l *KeyedLimiter) Get(key string) Limiter {
+	entry := l.acquire(key)
+	if entry == nil {
+		return nil
+	}
+	l.release(key, entry)
+	return entry.limiter
+}
+
+// Wait returns when the limiter of the key grants permission or times out.
+//
+// See the Wait receiver of the limiter the factory returns for the errors returned. Once the
+// KeyedLimiter is closed a LimiterClosed error is returned.
+func (l *KeyedLimiter) Wait(key string, timeout *time.Duration) error {
+	return l.do(key, func(limiter Limiter) error {
+		return limiter.Wait(timeout)
+	})
+}
+
+// WaitContext returns when the limiter of the key grants permission or the context is done.
+func (l *KeyedLimiter) WaitContext(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+func (l *KeyedLimiter) WaitN(ctx context.Context, key string, n int) error {
+	return l.do(key, func(limiter Limiter) error {
+		return limiter.WaitN(ctx, n)
+	})
+}
+
+// TryWait returns whether or not the limiter of the key granted permission.
+func (l *KeyedLimiter) TryWait(key string) (time.Duration, error) {
+	return l.TryWaitN(key, 1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+func (l *KeyedLimiter) TryWaitN(key string, n int) (time.Duration, error) {
+	var remaining time.Duration
+	err := l.do(key, func(limiter Limiter) error {
+		var err error
+		remaining, err = limiter.TryWaitN(n)
+		return err
+	})
+	return remaining, err
+}
+
+// Len returns the number of keys that currently have a limiter.
+func (l *KeyedLimiter) Len() int {
+	count := 0
+	for _, shard := range l.shards {
+		shard.mu.Lock()
+		count += len(shard.entries)
+		shard.mu.Unlock()
+	}
+	return count
+}
+
+// Close closes the limiters of all the keys and stops evicting idle keys.
+//
+// All subsequent requests return a LimiterClosed error. Calling Close more than once has no effect
+// and the returned error is always nil.
+func (l *KeyedLimiter) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+		for _, shard := range l.shards {
+			shard.mu.Lock()
+			shard.closed = true
+			for e := shard.lru.Front(); e != nil; e = e.Next() {
+				e.Value.(*keyedEntry).limiter.Close()
+			}
+			l.keys.Add(-int64(len(shard.entries)))
+			shard.entries = make(map[string]*list.Element)
+			shard.lru.Init()
+			shard.mu.Unlock()
+		}
+	})
+	return nil
+}
+
+// runs the request on the limiter of the key keeping the key from being evicted until it returns
+func (l *KeyedLimiter) do(key string, request func(limiter Limiter) error) error {
+	entry := l.acquire(key)
+	if entry == nil {
+		return newClosedError()
+	}
+	defer l.release(key, entry)
+	return request(entry.limiter)
+}
+
+// returns the entry of the key, creating it if needed, marked as active. Returns nil if the
+// KeyedLimiter is closed.
+func (l *KeyedLimiter) acquire(key string) *keyedEntry {
+	entry, created := l.shard(key).acquire(key, l.factory, l.clock.Now())
+	if created {
+		l.evictOverflow()
+	}
+	return entry
+}
+
+// returns the entry of the key marked as active and whether it was created. Returns nil if the
+// KeyedLimiter is closed.
+func (s *keyedShard) acquire(key string, factory func(key string) Limiter, now time.Time) (*keyedEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, false
+	}
+	if e, ok := s.entries[key]; ok {
+		s.lru.MoveToFront(e)
+		entry := e.Value.(*keyedEntry)
+		entry.lastUsed = now
+		entry.active++
+		return entry, false
+	}
+	// the new entry is active before evicting so it is never evicted in place of an older key
+	entry := &keyedEntry{
+		key:      key,
+		limiter:  factory(key),
+		lastUsed: now,
+		active:   1,
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	s.keys.Add(1)
+	return entry, true
+}
+
+// marks a request on the entry as done
+func (l *KeyedLimiter) release(key string, entry *keyedEntry) {
+	shard := l.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	entry.active--
+	entry.lastUsed = l.clock.Now()
+	if e, ok := shard.entries[key]; ok && e.Value.(*keyedEntry) == entry {
+		shard.lru.MoveToFront(e)
+	}
+}
+
+// returns the shard of the key
+func (l *KeyedLimiter) shard(key string) *keyedShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return l.shards[h.Sum32()%keyedShards]
+}
+
+// evicts the idle keys every ttl until the KeyedLimiter is closed
+func (l *KeyedLimiter) evictionLoop() {
+	for {
+		c, stop := l.clock.NewTimer(l.ttl)
+		select {
+		case <-c:
+			for _, shard := range l.shards {
+				shard.evictIdle(l.clock.Now().Add(-l.ttl))
+			}
+		case <-l.done:
+			stop()
+			return
+		}
+	}
+}
+
+// evicts the keys last used before the cutoff
+func (s *keyedShard) evictIdle(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the least recently used keys are at the back so stop at the first key used after the cutoff
+	for e := s.lru.Back(); e != nil; {
+		entry := e.Value.(*keyedEntry)
+		if entry.lastUsed.After(cutoff) {
+			return
+		}
+		prev := e.Prev()
+		if entry.active == 0 {
+			s.evict(e)
+		}
+		e = prev
+	}
+}
+
+// evicts the least recently used idle keys of all the shards while there are more than maxKeys keys.
+// The shards are locked one at a time, so a key used while the oldest key is looked for may be
+// evicted before a key that was idle for longer.
+func (l *KeyedLimiter) evictOverflow() {
+	if l.maxKeys <= 0 {
+		return
+	}
+	for l.keys.Load() > int64(l.maxKeys) {
+		var oldest *keyedShard
+		var oldestUsed time.Time
+		for _, shard := range l.shards {
+			if used, ok := shard.leastRecentlyUsed(); ok && (oldest == nil || used.Before(oldestUsed)) {
+				oldest, oldestUsed = shard, used
+			}
+		}
+		if oldest == nil { // every key has a request waiting
+			return
+		}
+		oldest.evictLeastRecentlyUsed(l.maxKeys)
+	}
+}
+
+// returns when the least recently used idle key of the shard was last used, false if the shard has
+// no idle key
+func (s *keyedShard) leastRecentlyUsed() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.leastRecentlyUsedElement(); e != nil {
+		return e.Value.(*keyedEntry).lastUsed, true
+	}
+	return time.Time{}, false
+}
+
+// evicts the least recently used idle key of the shard if there are still more than maxKeys keys
+func (s *keyedShard) evictLeastRecentlyUsed(maxKeys int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys.Load() <= int64(maxKeys) {
+		return
+	}
+	if e := s.leastRecentlyUsedElement(); e != nil {
+		s.evict(e)
+	}
+}
+
+// returns the least recently used key without a request waiting, nil if there is none. Must be
+// called while holding the lock.
+func (s *keyedShard) leastRecentlyUsedElement() *list.Element {
+	for e := s.lru.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*keyedEntry).active == 0 {
+			return e
+		}
+	}
+	return nil
+}
+
+// removes the key from the shard and closes its limiter. Must be called while holding the lock.
+func (s *keyedShard) evict(e *list.Element) {
+	entry := s.lru.Remove(e).(*keyedEntry)
+	delete(s.entries, entry.key)
+	s.keys.Add(-1)
+	entry.limiter.Close()
+}
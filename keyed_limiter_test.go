@@ -0,0 +1,226 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestKeyedLimiterWait(t *testing.T) {
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return NewUnbufferedLimiter(2, time.Second)
+	}, 0, 0)
+	defer limiter.Close()
+
+	tests := []struct {
+		name    string
+		key     string
+		wantErr bool
+	}{
+		{name: "First request for key a", key: "a", wantErr: false},
+		{name: "Second request for key a", key: "a", wantErr: false},
+		{name: "First request for key b", key: "b", wantErr: false},
+		{name: "Third request for key a", key: "a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, gotErr := limiter.TryWait(tt.key)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("KeyedLimiter.TryWait(%v), wantErr %v, got %v", tt.key, tt.wantErr, gotErr)
+			}
+		})
+	}
+	if got := limiter.Len(); got != 2 {
+		t.Errorf("KeyedLimiter.Len(), want 2, got %v", got)
+	}
+}
+
+func TestKeyedLimiterEviction(t *testing.T) {
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		maxKeys int
+		keys    int
+		sleep   time.Duration
+		wantLen int
+	}{
+		{
+			name:    "Idle keys evicted after the ttl",
+			ttl:     time.Second / 5,
+			maxKeys: 0,
+			keys:    10,
+			sleep:   time.Second / 2,
+			wantLen: 0,
+		},
+		{
+			name:    "Keys kept within the ttl",
+			ttl:     time.Second * 10,
+			maxKeys: 0,
+			keys:    10,
+			sleep:   0,
+			wantLen: 10,
+		},
+		{
+			name:    "Least recently used keys evicted over the bound",
+			ttl:     0,
+			maxKeys: keyedShards,
+			keys:    keyedShards * 4,
+			sleep:   0,
+			wantLen: keyedShards,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			created := []*BufferedLimiter{}
+			limiter := NewKeyedLimiter(func(key string) Limiter {
+				mu.Lock()
+				defer mu.Unlock()
+				l := NewBufferedLimiter(1, 1, time.Second)
+				created = append(created, l)
+				return l
+			}, tt.ttl, tt.maxKeys)
+			defer limiter.Close()
+
+			for i := 0; i < tt.keys; i++ {
+				if err := limiter.WaitContext(context.Background(), fmt.Sprint(i)); err != nil {
+					t.Errorf("KeyedLimiter.WaitContext(), want nil, got %v", err)
+				}
+			}
+			time.Sleep(tt.sleep)
+
+			if gotLen := limiter.Len(); gotLen > tt.wantLen {
+				t.Errorf("KeyedLimiter.Len(), want at most %v, got %v", tt.wantLen, gotLen)
+			}
+			// every evicted limiter must be closed
+			closed := 0
+			for _, l := range created {
+				if l.isClosed() {
+					closed++
+				}
+			}
+			if gotLen := limiter.Len(); closed != tt.keys-gotLen {
+				t.Errorf("KeyedLimiter evicted limiters, want %v closed, got %v", tt.keys-gotLen, closed)
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterMaxKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxKeys int
+		keys    int
+	}{
+		{
+			name:    "Fewer keys than shards",
+			maxKeys: 2,
+			keys:    10,
+		},
+		{
+			name:    "Keys within the bound are all kept",
+			maxKeys: keyedShards * 2,
+			keys:    keyedShards * 2,
+		},
+		{
+			name:    "Least recently used keys evicted across the shards",
+			maxKeys: keyedShards + 1,
+			keys:    keyedShards * 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewKeyedLimiter(func(key string) Limiter {
+				return NewUnbufferedLimiter(1, time.Hour)
+			}, 0, tt.maxKeys, WithClock(clock))
+			defer limiter.Close()
+
+			for i := 0; i < tt.keys; i++ {
+				clock.Advance(time.Millisecond)
+				limiter.TryWait(fmt.Sprint(i))
+			}
+			wantLen := min(tt.keys, tt.maxKeys)
+			if got := limiter.Len(); got != wantLen {
+				t.Errorf("KeyedLimiter.Len(), want %v, got %v", wantLen, got)
+			}
+			// the most recently used keys are kept, their limiters already granted the permit
+			for i := tt.keys - wantLen; i < tt.keys; i++ {
+				if _, err := limiter.TryWait(fmt.Sprint(i)); !errors.Is(err, ErrOverLimit) {
+					t.Errorf("KeyedLimiter.TryWait(%v) of a kept key, want LimiterOverLimitError, got %v", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterEvictionWithActiveKey(t *testing.T) {
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return NewUnbufferedLimiter(1, time.Hour)
+	}, 0, 1)
+	defer limiter.Close()
+
+	// find a second key in the same shard as the first
+	active := "active"
+	fresh := ""
+	for i := 0; fresh == ""; i++ {
+		if key := fmt.Sprint(i); limiter.shard(key) == limiter.shard(active) {
+			fresh = key
+		}
+	}
+
+	limiter.TryWait(active)
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() {
+		waited <- limiter.WaitContext(ctx, active)
+	}()
+	for {
+		shard := limiter.shard(active)
+		shard.mu.Lock()
+		waiting := shard.entries[active].Value.(*keyedEntry).active > 0
+		shard.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := limiter.TryWait(fresh); err != nil {
+		t.Errorf("KeyedLimiter.TryWait() of a new key in the shard of an active key, want nil, got %v", err)
+	}
+	// the limiter of the new key was kept and already granted its permit
+	if _, err := limiter.TryWait(fresh); !errors.Is(err, ErrOverLimit) {
+		t.Errorf("KeyedLimiter.TryWait() of the new key again, want LimiterOverLimitError, got %v", err)
+	}
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Errorf("KeyedLimiter.WaitContext() of the active key, want context.Canceled, got %v", err)
+	}
+}
+
+func TestKeyedLimiterClose(t *testing.T) {
+	limiter := NewKeyedLimiter(func(key string) Limiter {
+		return NewUnbufferedLimiter(1, time.Second)
+	}, time.Second, 0)
+	if _, err := limiter.TryWait("a"); err != nil {
+		t.Errorf("KeyedLimiter.TryWait(), want nil, got %v", err)
+	}
+	limiter.Close()
+
+	var closed *LimiterClosedError
+	if err := limiter.Wait("a", nil); !errors.As(err, &closed) {
+		t.Errorf("KeyedLimiter.Wait() after Close, want LimiterClosedError, got %v", err)
+	}
+	if got := limiter.Len(); got != 0 {
+		t.Errorf("KeyedLimiter.Len() after Close, want 0, got %v", got)
+	}
+}
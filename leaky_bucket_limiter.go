@@ -0,0 +1,190 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A LeakyBucketLimiter is a limiter without an internal buffer that spaces permissions evenly at a
+// given rate and time interval
+type LeakyBucketLimiter struct {
+	mu       *sync.Mutex
+	rate     int
+	slack    int
+	interval time.Duration
+	// the spacing between permits is interval/rate, kept as the whole nanoseconds and the remainder
+	// so rates above one per nanosecond still space the permits
+	spacing   time.Duration
+	remainder int64
+	// the fraction of a nanosecond the schedule is past next, in units of 1/rate nanoseconds
+	carry  int64
+	next   time.Time
+	clock  Clock
+	closed bool
+}
+
+// NewLeakyBucketLimiter returns a new LeakyBucketLimiter given a rate, slack and time interval.
+//
+// The LeakyBucketLimiter grants permissions one every interval/rate so the operations it limits are
+// spread evenly over the interval instead of being granted all at once like the UnbufferedLimiter
+// does. The slack is the number of permits that may be granted ahead of schedule, allowing small
+// bursts after a quiet period, a slack of 0 spaces every permit exactly.
+//
+// If the rate received <= 0 the rate will default to 1, if the slack received < 0 it will be set
+// to 0 and if the interval received <= 0 it will be set to 1 millisecond. This is to prevent the
+// LeakyBucketLimiter from erroring during use without the NewLeakyBucketLimiter function returning
+// an error.
+//
+// The options configure the rest of the LeakyBucketLimiter, such as the clock it uses.
+func NewLeakyBucketLimiter(rate, slack int, interval time.Duration, opts ...Option) *LeakyBucketLimiter {
+	o := newOptions(opts)
+	if rate <= 0 {
+		rate = 1
+	}
+	if slack < 0 {
+		slack = 0
+	}
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return &LeakyBucketLimiter{
+		mu:        &sync.Mutex{},
+		rate:      rate,
+		slack:     slack,
+		interval:  interval,
+		spacing:   interval / time.Duration(rate),
+		remainder: int64(interval % time.Duration(rate)),
+		carry:     0,
+		next:      time.Time{},
+		clock:     o.clock,
+		closed:    false,
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// The Wait receiver on the LeakyBucketLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// LeakyBucketLimiter will grant permission.
+func (l *LeakyBucketLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned.
+func (l *LeakyBucketLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// The n permits take up n spaces in the schedule so the next permit is granted n*interval/rate
+// later. If n is greater than the rate a LimiterRequestTooLarge error is returned, and if n <= 0
+// WaitN returns nil immediately.
+func (l *LeakyBucketLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, l.TryWaitN)
+}
+
+// TryWait returns whether or not the LeakyBucketLimiter granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
+// is nil. If permission is not granted a LimiterOverLimit error is returned and the time duration
+// until the next permit is scheduled. Once the limiter is closed a LimiterClosed error is returned.
+func (l *LeakyBucketLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned, and if n <= 0 nothing is granted and the error is nil.
+func (l *LeakyBucketLimiter) TryWaitN(n int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	remaining, err := l.checkN(n)
+	if err != nil || n <= 0 {
+		return remaining, err
+	}
+	l.commitN(n)
+	return 0, nil
+}
+
+func (l *LeakyBucketLimiter) lock()   { l.mu.Lock() }
+func (l *LeakyBucketLimiter) unlock() { l.mu.Unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *LeakyBucketLimiter) checkN(n int) (time.Duration, error) {
+	if l.closed {
+		return 0, newClosedError()
+	}
+	if n > l.rate {
+		return 0, newRequestTooLargeError(l.rate)
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	now := l.clock.Now()
+	// a permit may be granted up to slack spaces ahead of its scheduled time
+	ahead, _ := l.spaces(l.slack)
+	remaining := l.scheduled(now).Sub(now) - ahead
+	if remaining > 0 {
+		return remaining, newOverLimitError(remaining, l.rate)
+	}
+	return 0, nil
+}
+
+// schedules n permits. Must be called while holding the lock after checkN allowed them.
+func (l *LeakyBucketLimiter) commitN(n int) {
+	now := l.clock.Now()
+	if l.next.Before(now) { // the schedule restarts from now
+		l.carry = 0
+	}
+	d, fraction := l.spaces(n)
+	fraction += l.carry
+	if fraction >= int64(l.rate) {
+		d++
+		fraction -= int64(l.rate)
+	}
+	l.next = l.scheduled(now).Add(d)
+	l.carry = fraction
+}
+
+// returns the duration of n spaces in the schedule, n*interval/rate rounded down, and the fraction
+// of a nanosecond left over in units of 1/rate nanoseconds
+func (l *LeakyBucketLimiter) spaces(n int) (time.Duration, int64) {
+	fraction := int64(n) * l.remainder
+	return time.Duration(n)*l.spacing + time.Duration(fraction/int64(l.rate)), fraction % int64(l.rate)
+}
+
+// returns the time the next permit is scheduled for, now if the schedule fell behind and the
+// bucket is empty
+func (l *LeakyBucketLimiter) scheduled(now time.Time) time.Time {
+	if l.next.Before(now) {
+		return now
+	}
+	return l.next
+}
+
+// Close closes the LeakyBucketLimiter.
+//
+// The LeakyBucketLimiter holds no resources so Close only marks the limiter as closed, all
+// subsequent calls to Wait and TryWait return a LimiterClosed error. Calling Close more than once
+// has no effect and the returned error is always nil.
+func (l *LeakyBucketLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
@@ -0,0 +1,131 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestLeakyBucketWait(t *testing.T) {
+	tests := []struct {
+		name       string
+		limiter    *LeakyBucketLimiter
+		count      int
+		minSpacing time.Duration
+		maxSpacing time.Duration
+		slack      int
+	}{
+		{
+			name:       "5 per second spaced 200ms apart",
+			limiter:    NewLeakyBucketLimiter(5, 0, time.Second),
+			count:      5,
+			minSpacing: time.Second/5 - time.Millisecond*20,
+			maxSpacing: time.Second/5 + time.Millisecond*50,
+			slack:      0,
+		},
+		{
+			name:       "5 per second with slack of 2",
+			limiter:    NewLeakyBucketLimiter(5, 2, time.Second),
+			count:      6,
+			minSpacing: time.Second/5 - time.Millisecond*20,
+			maxSpacing: time.Second/5 + time.Millisecond*50,
+			slack:      2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grants := make([]time.Time, tt.count)
+			for i := 0; i < tt.count; i++ {
+				if gotErr := tt.limiter.Wait(nil); gotErr != nil {
+					t.Errorf("LeakyBucketLimiter.Wait() %v/%v, want nil, got %v", i+1, tt.count, gotErr)
+				}
+				grants[i] = time.Now()
+			}
+			// the first permit and the slack permits are granted right away, the one after that waits
+			// for the schedule to catch up and the rest are spaced evenly
+			for i := 1; i <= tt.slack; i++ {
+				if gotSpacing := grants[i].Sub(grants[i-1]); gotSpacing > time.Millisecond*20 {
+					t.Errorf("LeakyBucketLimiter.Wait() slack %v/%v, want no spacing, got %v", i, tt.slack, gotSpacing)
+				}
+			}
+			for i := tt.slack + 2; i < tt.count; i++ {
+				gotSpacing := grants[i].Sub(grants[i-1])
+				if gotSpacing < tt.minSpacing || gotSpacing > tt.maxSpacing {
+					t.Errorf("LeakyBucketLimiter.Wait() %v/%v, wantSpacing in range (%v, %v) got %v", i+1, tt.count, tt.minSpacing, tt.maxSpacing, gotSpacing)
+				}
+			}
+		})
+	}
+}
+
+func TestLeakyBucketTryWait(t *testing.T) {
+	limiter := NewLeakyBucketLimiter(4, 0, time.Second)
+	if _, err := limiter.TryWait(); err != nil {
+		t.Errorf("LeakyBucketLimiter.TryWait(), want nil, got %v", err)
+	}
+	remaining, err := limiter.TryWait()
+	if err == nil {
+		t.Errorf("LeakyBucketLimiter.TryWait() before the next space, want LimiterOverLimitError, got nil")
+	}
+	if remaining > time.Second/4 || remaining < time.Second/4-time.Millisecond*20 {
+		t.Errorf("LeakyBucketLimiter.TryWait(), wantRemaining about %v, got %v", time.Second/4, remaining)
+	}
+	if _, err := limiter.TryWaitN(5); err == nil {
+		t.Errorf("LeakyBucketLimiter.TryWaitN(5), want LimiterRequestTooLargeError, got nil")
+	}
+}
+
+func TestLeakyBucketSubNanosecondSpacing(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int
+		interval time.Duration
+		steps    int
+		want     int
+	}{
+		{
+			name:     "2000 per microsecond",
+			rate:     2000,
+			interval: time.Microsecond,
+			steps:    1000,
+			want:     2000,
+		},
+		{
+			name:     "3 per 2 nanoseconds",
+			rate:     3,
+			interval: 2,
+			steps:    10,
+			want:     15,
+		},
+		{
+			name:     "Lenient interval with a rate above one per nanosecond",
+			rate:     2_000_000,
+			interval: 0,
+			steps:    500,
+			want:     1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewLeakyBucketLimiter(tt.rate, 0, tt.interval, WithClock(clock))
+			// advance a nanosecond at a time taking every permit the schedule allows
+			granted := 0
+			for i := 0; i < tt.steps; i++ {
+				for {
+					if _, err := limiter.TryWait(); err != nil {
+						break
+					}
+					granted++
+				}
+				clock.Advance(time.Nanosecond)
+			}
+			if granted != tt.want {
+				t.Errorf("LeakyBucketLimiter.TryWait() over %v nanoseconds, want %v granted, got %v", tt.steps, tt.want, granted)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package rate
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter is the interface implemented by the limiters in this package.
+//
+// Code that only needs to wait for permission should depend on a Limiter instead of a concrete
+// limiter so the limiting strategy can be chosen at run time, for example through configuration.
+type Limiter interface {
+	// Wait blocks until permission is granted or the timeout, if not nil, expires.
+	Wait(timeout *time.Duration) error
+
+	// WaitContext blocks until permission is granted or the context is done.
+	WaitContext(ctx context.Context) error
+
+	// TryWait returns immediately, with a nil error if permission was granted and otherwise an
+	// error and the time until permission could be granted.
+	TryWait() (time.Duration, error)
+
+	// WaitN is like WaitContext but waits for n permits at once.
+	WaitN(ctx context.Context, n int) error
+
+	// TryWaitN is like TryWait but asks for n permits at once.
+	TryWaitN(n int) (time.Duration, error)
+
+	// Close releases the resources held by the limiter. Requests made after Close return a
+	// LimiterClosedError.
+	Close() error
+}
+
+var (
+	_ Limiter = (*BufferedLimiter)(nil)
+	_ Limiter = (*UnbufferedLimiter)(nil)
+	_ Limiter = (*TokenBucketLimiter)(nil)
+	_ Limiter = (*LeakyBucketLimiter)(nil)
+	_ Limiter = (*FixedWindowLimiter)(nil)
+	_ Limiter = (*SlidingWindowLimiter)(nil)
+	_ Limiter = (*AdaptiveLimiter)(nil)
+	_ Limiter = (*DistributedLimiter)(nil)
+	_ Limiter = (*CompositeLimiter)(nil)
+)
+
+// pollWaitN blocks until tryWaitN grants n permits or the context is done, sleeping on the clock
+// for the remaining duration tryWaitN returns between attempts. Errors other than LimiterOverLimit
+// are returned as is.
+func pollWaitN(ctx context.Context, clock Clock, n int, tryWaitN func(n int) (time.Duration, error)) error {
+	if ctx.Err() != nil {
+		return contextError(ctx, 0)
+	}
+	start := clock.Now()
+	for {
+		remaining, err := tryWaitN(n)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(*LimiterOverLimitError); !ok {
+			return err
+		}
+		if ok := sleepContext(ctx, clock, remaining); !ok {
+			return contextError(ctx, clock.Now().Sub(start))
+		}
+	}
+}
+
+// returns the time stamps resized to rate, keeping the most recent ones, with the index of the
+// oldest time stamp. The time stamps are in the order they were recorded starting at the index, the
+// resized time stamps stay in that order with the unused slots first so they are granted first.
+func resizeTimeStamps(timeStamps []time.Time, index, rate int) ([]time.Time, int) {
+	resized := make([]time.Time, rate)
+	kept := min(rate, len(timeStamps))
+	for i := 0; i < kept; i++ {
+		// copy from the most recent backwards
+		from := (index - 1 - i + len(timeStamps)) % len(timeStamps)
+		resized[rate-1-i] = timeStamps[from]
+	}
+	return resized, 0
+}
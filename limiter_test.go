@@ -0,0 +1,44 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter Limiter
+		count   int
+	}{
+		{
+			name:    "BufferedLimiter",
+			limiter: NewBufferedLimiter(3, 3, time.Second),
+			count:   3,
+		},
+		{
+			name:    "UnbufferedLimiter",
+			limiter: NewUnbufferedLimiter(3, time.Second),
+			count:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < tt.count; i++ {
+				if err := tt.limiter.WaitContext(context.Background()); err != nil {
+					t.Errorf("Limiter.WaitContext() %v/%v, want nil, got %v", i+1, tt.count, err)
+				}
+			}
+			if err := tt.limiter.Close(); err != nil {
+				t.Errorf("Limiter.Close(), want nil, got %v", err)
+			}
+			var closed *LimiterClosedError
+			if err := tt.limiter.Wait(nil); !errors.As(err, &closed) {
+				t.Errorf("Limiter.Wait() after Close, want LimiterClosedError, got %v", err)
+			}
+		})
+	}
+}
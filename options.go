@@ -0,0 +1,168 @@
+package rate
+
+import (
+	"fmt"
+	"time"
+)
+
+// Option configures a limiter when passed to its constructor.
+type Option func(*options)
+
+// the configuration shared by all limiters
+type options struct {
+	clock    Clock
+	rate     int
+	interval time.Duration
+	capacity int
+	aging    time.Duration
+	fair     bool
+	buffered bool // an option that only configures a BufferedLimiter was received
+}
+
+// returns the options with the defaults for the ones not received
+func newOptions(opts []Option) *options {
+	o := &options{
+		clock:    systemClock{},
+		rate:     0,
+		interval: 0,
+		capacity: 0,
+		aging:    0,
+		fair:     false,
+		buffered: false,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithClock sets the clock the limiter uses to tell time, the system clock is used by default.
+// A nil clock is ignored.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+// WithRate sets the number of permissions the limiter grants per time interval. It is required by
+// New, NewBuffered and NewUnbuffered, the rate and interval must both be > 0.
+func WithRate(rate int, interval time.Duration) Option {
+	return func(o *options) {
+		o.rate = rate
+		o.interval = interval
+	}
+}
+
+// WithCapacity sets the capacity of the buffer of a BufferedLimiter. It is required by
+// NewBuffered and must be > 0. Passing it to New creates a BufferedLimiter.
+func WithCapacity(capacity int) Option {
+	return func(o *options) {
+		o.capacity = capacity
+		o.buffered = true
+	}
+}
+
+// WithPriorityAging raises the priority of the requests waiting in the buffer of a BufferedLimiter
+// by one for every aging duration they waited, so requests with a low priority are eventually
+// granted. Requests are not aged by default.
+func WithPriorityAging(aging time.Duration) Option {
+	return func(o *options) {
+		o.aging = aging
+		o.buffered = true
+	}
+}
+
+// WithFairQueueing makes the buffer of a BufferedLimiter fair between the flows of WaitFlow, the
+// flows take turns being granted permission and the capacity of the buffer applies to each flow
+// instead of all the requests.
+func WithFairQueueing() Option {
+	return func(o *options) {
+		o.fair = true
+		o.buffered = true
+	}
+}
+
+// New returns a new Limiter configured by the options, or a LimiterConfigError if the options are
+// invalid.
+//
+// The limiter is a BufferedLimiter when WithCapacity, WithPriorityAging or WithFairQueueing is
+// received, whatever their values, and an UnbufferedLimiter otherwise. See NewBuffered and
+// NewUnbuffered for the options each requires, a capacity of 0 or one of the other buffer options
+// without WithCapacity returns a LimiterConfigError.
+func New(opts ...Option) (Limiter, error) {
+	// return an untyped nil on error so the returned Limiter compares equal to nil
+	if o := newOptions(opts); o.buffered {
+		l, err := NewBuffered(opts...)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	l, err := NewUnbuffered(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewBuffered returns a new BufferedLimiter configured by the options, or a LimiterConfigError if
+// the options are invalid.
+//
+// Unlike NewBufferedLimiter, which replaces invalid values with defaults, NewBuffered requires
+// WithRate and WithCapacity with values > 0 so a missing or invalid configuration is reported
+// instead of silently creating a limiter with an unintended rate.
+func NewBuffered(opts ...Option) (*BufferedLimiter, error) {
+	o := newOptions(opts)
+	if err := o.validateRate(); err != nil {
+		return nil, err
+	}
+	if o.capacity <= 0 {
+		return nil, newConfigError("capacity", o.capacity)
+	}
+	return newBufferedLimiter(o), nil
+}
+
+// NewUnbuffered returns a new UnbufferedLimiter configured by the options, or a LimiterConfigError
+// if the options are invalid.
+//
+// Unlike NewUnbufferedLimiter, which replaces invalid values with defaults, NewUnbuffered requires
+// WithRate with values > 0 so a missing or invalid configuration is reported instead of silently
+// creating a limiter with an unintended rate.
+func NewUnbuffered(opts ...Option) (*UnbufferedLimiter, error) {
+	o := newOptions(opts)
+	if err := o.validateRate(); err != nil {
+		return nil, err
+	}
+	return newUnbufferedLimiter(o), nil
+}
+
+// returns a LimiterConfigError if the rate or interval are not > 0
+func (o *options) validateRate() error {
+	if o.rate <= 0 {
+		return newConfigError("rate", o.rate)
+	}
+	if o.interval <= 0 {
+		return newConfigError("interval", o.interval)
+	}
+	return nil
+}
+
+// replaces invalid values with the defaults of the lenient constructors
+func (o *options) lenient() {
+	if o.rate <= 0 {
+		o.rate = 1
+	}
+	if o.interval <= 0 {
+		o.interval = time.Millisecond
+	}
+	if o.capacity <= 0 {
+		o.capacity = 1
+	}
+}
+
+// returns the LimiterConfigError for an option whose value must be > 0
+func newConfigError(option string, value any) *LimiterConfigError {
+	return &LimiterConfigError{message: fmt.Sprintf("invalid configuration: %s must be > 0, got %v", option, value)}
+}
@@ -0,0 +1,110 @@
+package rate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantErr      bool
+		wantBuffered bool
+	}{
+		{
+			name:         "Unbuffered",
+			opts:         []Option{WithRate(5, time.Second)},
+			wantErr:      false,
+			wantBuffered: false,
+		},
+		{
+			name:         "Buffered",
+			opts:         []Option{WithRate(5, time.Second), WithCapacity(10)},
+			wantErr:      false,
+			wantBuffered: true,
+		},
+		{
+			name:    "Missing rate",
+			opts:    []Option{},
+			wantErr: true,
+		},
+		{
+			name:    "Rate of 0",
+			opts:    []Option{WithRate(0, time.Second)},
+			wantErr: true,
+		},
+		{
+			name:    "Interval of 0",
+			opts:    []Option{WithRate(5, 0)},
+			wantErr: true,
+		},
+		{
+			name:    "Negative capacity",
+			opts:    []Option{WithRate(5, time.Second), WithCapacity(-1)},
+			wantErr: true,
+		},
+		{
+			name:    "Capacity of 0",
+			opts:    []Option{WithRate(5, time.Second), WithCapacity(0)},
+			wantErr: true,
+		},
+		{
+			name:    "Fair queueing without capacity",
+			opts:    []Option{WithRate(5, time.Second), WithFairQueueing()},
+			wantErr: true,
+		},
+		{
+			name:    "Priority aging without capacity",
+			opts:    []Option{WithRate(5, time.Second), WithPriorityAging(time.Second)},
+			wantErr: true,
+		},
+		{
+			name:         "Fair queueing with capacity",
+			opts:         []Option{WithRate(5, time.Second), WithCapacity(2), WithFairQueueing()},
+			wantErr:      false,
+			wantBuffered: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotLimiter, gotErr := New(tt.opts...)
+			if (gotErr != nil) != tt.wantErr {
+				t.Fatalf("New(), wantErr %v, got %v", tt.wantErr, gotErr)
+			}
+			if tt.wantErr {
+				var configErr *LimiterConfigError
+				if !errors.As(gotErr, &configErr) {
+					t.Errorf("New(), want LimiterConfigError, got %v", gotErr)
+				}
+				if gotLimiter != nil {
+					t.Errorf("New(), want nil limiter, got %v", gotLimiter)
+				}
+				return
+			}
+			defer gotLimiter.Close()
+			if _, gotBuffered := gotLimiter.(*BufferedLimiter); gotBuffered != tt.wantBuffered {
+				t.Errorf("New(), want BufferedLimiter %v, got %T", tt.wantBuffered, gotLimiter)
+			}
+			if _, err := gotLimiter.TryWait(); err != nil {
+				t.Errorf("New() Limiter.TryWait(), want nil, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewBuffered(t *testing.T) {
+	if _, err := NewBuffered(WithRate(5, time.Second)); err == nil {
+		t.Errorf("NewBuffered() without capacity, want LimiterConfigError, got nil")
+	}
+	limiter, err := NewBuffered(WithRate(5, time.Second), WithCapacity(2))
+	if err != nil {
+		t.Fatalf("NewBuffered(), want nil, got %v", err)
+	}
+	defer limiter.Close()
+	if limiter.rate != 5 || limiter.interval != time.Second || limiter.buffer.capacity != 2 {
+		t.Errorf("NewBuffered(), want rate 5, interval 1s and capacity 2, got %v, %v and %v", limiter.rate, limiter.interval, limiter.buffer.capacity)
+	}
+}
@@ -0,0 +1,290 @@
+package rate
+
+import (
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*UnbufferedLimiter)(nil)
+	_ encoding.BinaryUnmarshaler = (*UnbufferedLimiter)(nil)
+	_ json.Marshaler             = (*UnbufferedLimiter)(nil)
+	_ json.Unmarshaler           = (*UnbufferedLimiter)(nil)
+	_ encoding.BinaryMarshaler   = (*BufferedLimiter)(nil)
+	_ encoding.BinaryUnmarshaler = (*BufferedLimiter)(nil)
+	_ json.Marshaler             = (*BufferedLimiter)(nil)
+	_ json.Unmarshaler           = (*BufferedLimiter)(nil)
+)
+
+// the version of the binary encoding, the first byte of the encoded state
+const stateVersion = 1
+
+// the state of a limiter that keeps the time of its recent grants, which is what is persisted
+// across restarts
+type timeStampState struct {
+	Rate int `json:"rate"`
+	// Interval is in nanoseconds
+	Interval   time.Duration `json:"interval"`
+	Index      int           `json:"index"`
+	TimeStamps []time.Time   `json:"timeStamps"`
+}
+
+// returns a copy of the time stamps with the rate and interval of the limiter
+func newTimeStampState(timeStamps []time.Time, index int, interval time.Duration) *timeStampState {
+	return &timeStampState{
+		Rate:       len(timeStamps),
+		Interval:   interval,
+		Index:      index,
+		TimeStamps: append([]time.Time(nil), timeStamps...),
+	}
+}
+
+// returns a LimiterConfigError if the state can't be restored
+func (s *timeStampState) validate() error {
+	o := &options{rate: s.Rate, interval: s.Interval}
+	if err := o.validateRate(); err != nil {
+		return err
+	}
+	if len(s.TimeStamps) != s.Rate || s.Index < 0 || s.Index >= s.Rate {
+		return &LimiterConfigError{message: "invalid configuration: malformed limiter state"}
+	}
+	return nil
+}
+
+// encodes the state as the version followed by the rate, interval, index and the time stamps in Unix
+// nanoseconds as varints, the time stamps of unused slots are 0
+func (s *timeStampState) MarshalBinary() ([]byte, error) {
+	data := []byte{stateVersion}
+	data = binary.AppendUvarint(data, uint64(s.Rate))
+	data = binary.AppendVarint(data, int64(s.Interval))
+	data = binary.AppendUvarint(data, uint64(s.Index))
+	for _, t := range s.TimeStamps {
+		var nanos int64
+		if !t.IsZero() {
+			nanos = t.UnixNano()
+		}
+		data = binary.AppendVarint(data, nanos)
+	}
+	return data, nil
+}
+
+// decodes the state encoded by MarshalBinary
+func (s *timeStampState) UnmarshalBinary(data []byte) error {
+	malformed := &LimiterConfigError{message: "invalid configuration: malformed limiter state"}
+	if len(data) == 0 || data[0] != stateVersion {
+		return malformed
+	}
+	data = data[1:]
+	rate, n := binary.Uvarint(data)
+	if n <= 0 || rate == 0 || rate > uint64(len(data)) { // every time stamp takes at least a byte
+		return malformed
+	}
+	data = data[n:]
+	interval, n := binary.Varint(data)
+	if n <= 0 {
+		return malformed
+	}
+	data = data[n:]
+	index, n := binary.Uvarint(data)
+	if n <= 0 || index >= rate {
+		return malformed
+	}
+	data = data[n:]
+	timeStamps := make([]time.Time, rate)
+	for i := range timeStamps {
+		nanos, n := binary.Varint(data)
+		if n <= 0 {
+			return malformed
+		}
+		data = data[n:]
+		if nanos != 0 {
+			timeStamps[i] = time.Unix(0, nanos)
+		}
+	}
+	if len(data) != 0 {
+		return malformed
+	}
+	s.Rate = int(rate)
+	s.Interval = time.Duration(interval)
+	s.Index = int(index)
+	s.TimeStamps = timeStamps
+	return nil
+}
+
+// MarshalBinary encodes the rate, interval and recent grants of the UnbufferedLimiter so they can be
+// restored with UnmarshalBinary, for example after a restart. The reservations that are still in the
+// future are not part of the state.
+func (l *UnbufferedLimiter) MarshalBinary() ([]byte, error) {
+	return l.state().MarshalBinary()
+}
+
+// UnmarshalBinary restores the rate, interval and recent grants encoded by MarshalBinary, replacing
+// those of the UnbufferedLimiter. The grants keep counting against the rate until they are older
+// than the interval, as if the limiter had never stopped. Data that can't be decoded returns a
+// LimiterConfig error and leaves the limiter unchanged.
+//
+// UnmarshalBinary must be called on a limiter returned by one of the constructors, the clock and
+// the other options are not part of the encoded state.
+func (l *UnbufferedLimiter) UnmarshalBinary(data []byte) error {
+	s := &timeStampState{}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	return l.restoreState(s)
+}
+
+// MarshalJSON is like MarshalBinary but encodes the state of the UnbufferedLimiter as JSON.
+func (l *UnbufferedLimiter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.state())
+}
+
+// UnmarshalJSON is like UnmarshalBinary but decodes the state encoded by MarshalJSON.
+func (l *UnbufferedLimiter) UnmarshalJSON(data []byte) error {
+	s := &timeStampState{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	return l.restoreState(s)
+}
+
+func (l *UnbufferedLimiter) state() *timeStampState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settle(l.clock.Now())
+	return newTimeStampState(l.timeStamps, l.index, l.interval)
+}
+
+func (l *UnbufferedLimiter) restoreState(s *timeStampState) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settle(l.clock.Now())
+	l.timeStamps = s.TimeStamps
+	l.index = s.Index
+	l.interval = s.Interval
+	return nil
+}
+
+// MarshalBinary encodes the rate, interval and recent approvals of the BufferedLimiter so they can
+// be restored with UnmarshalBinary, for example after a restart. The requests waiting in the buffer
+// are not part of the state.
+func (l *BufferedLimiter) MarshalBinary() ([]byte, error) {
+	return l.state().MarshalBinary()
+}
+
+// UnmarshalBinary restores the rate, interval and recent approvals encoded by MarshalBinary,
+// replacing those of the BufferedLimiter. The approvals keep counting against the rate until they
+// are older than the interval, as if the limiter had never stopped. Like with SetRate the buffered
+// requests for more permits than the restored rate return a LimiterRequestTooLarge error. Data that
+// can't be decoded returns a LimiterConfig error and leaves the limiter unchanged.
+//
+// UnmarshalBinary must be called on a limiter returned by one of the constructors, the capacity,
+// clock and the other options are not part of the encoded state.
+func (l *BufferedLimiter) UnmarshalBinary(data []byte) error {
+	s := &timeStampState{}
+	if err := s.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	return l.restoreState(s)
+}
+
+// MarshalJSON is like MarshalBinary but encodes the state of the BufferedLimiter as JSON.
+func (l *BufferedLimiter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.state())
+}
+
+// UnmarshalJSON is like UnmarshalBinary but decodes the state encoded by MarshalJSON.
+func (l *BufferedLimiter) UnmarshalJSON(data []byte) error {
+	s := &timeStampState{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return err
+	}
+	return l.restoreState(s)
+}
+
+func (l *BufferedLimiter) state() *timeStampState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return newTimeStampState(l.timeStamps, l.index, l.interval)
+}
+
+func (l *BufferedLimiter) restoreState(s *timeStampState) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.timeStamps = s.TimeStamps
+	l.index = s.Index
+	l.rate = s.Rate
+	l.interval = s.Interval
+	l.buffer.denyLarger(s.Rate)
+	l.buffer.wake()
+	return nil
+}
+
+// WriteCheckpoint writes the state of the limiter encoded with MarshalBinary to the file at path.
+//
+// The state is written to a temporary file in the same directory which then replaces the file at
+// path, so a crash while writing never leaves a partial checkpoint behind.
+func WriteCheckpoint(limiter encoding.BinaryMarshaler, path string) error {
+	data, err := limiter.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no effect once renamed
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// ReadCheckpoint restores the state of the limiter from the file at path written by
+// WriteCheckpoint. If there is no checkpoint yet the returned error matches fs.ErrNotExist and the
+// limiter is unchanged.
+func ReadCheckpoint(limiter encoding.BinaryUnmarshaler, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return limiter.UnmarshalBinary(data)
+}
+
+// Checkpoint writes the state of the limiter to the file at path every period until the context is
+// done, then writes it a last time so the checkpoint has the grants up to the shutdown.
+//
+// Checkpoint blocks, run it on its own goroutine and cancel the context before the process exits.
+// It stops at the first checkpoint that can't be written and returns its error, otherwise it
+// returns nil once the context is done. A period <= 0 returns a LimiterConfig error. The options
+// configure the clock used to wait between checkpoints.
+func Checkpoint(ctx context.Context, limiter encoding.BinaryMarshaler, path string, period time.Duration, opts ...Option) error {
+	if period <= 0 {
+		return newConfigError("period", period)
+	}
+	o := newOptions(opts)
+	for sleepContext(ctx, o.clock, period) {
+		if err := WriteCheckpoint(limiter, path); err != nil {
+			return err
+		}
+	}
+	return WriteCheckpoint(limiter, path)
+}
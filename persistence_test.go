@@ -0,0 +1,158 @@
+package rate
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestUnbufferedMarshal(t *testing.T) {
+	tests := []struct {
+		name      string
+		marshal   func(l *UnbufferedLimiter) ([]byte, error)
+		unmarshal func(l *UnbufferedLimiter, data []byte) error
+	}{
+		{
+			name:      "Binary",
+			marshal:   (*UnbufferedLimiter).MarshalBinary,
+			unmarshal: (*UnbufferedLimiter).UnmarshalBinary,
+		},
+		{
+			name:      "JSON",
+			marshal:   (*UnbufferedLimiter).MarshalJSON,
+			unmarshal: (*UnbufferedLimiter).UnmarshalJSON,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewUnbufferedLimiter(3, time.Second, WithClock(clock))
+			limiter.TryWait()
+			clock.Advance(time.Millisecond * 100)
+			limiter.TryWait()
+			limiter.TryWait()
+			// the oldest grant is not the first time stamp once the ring wrapped
+			clock.Advance(time.Second)
+			limiter.TryWait()
+			data, err := tt.marshal(limiter)
+			if err != nil {
+				t.Fatalf("UnbufferedLimiter marshal, want nil, got %v", err)
+			}
+
+			restarted := NewUnbufferedLimiter(1, time.Minute, WithClock(clock))
+			if err := tt.unmarshal(restarted, data); err != nil {
+				t.Fatalf("UnbufferedLimiter unmarshal, want nil, got %v", err)
+			}
+			if s := restarted.Stats(); s.Rate != 3 || s.Interval != time.Second || s.Available != 2 {
+				t.Errorf("UnbufferedLimiter.Stats() after unmarshal, want rate 3, interval 1s and 2 available, got %v, %v and %v", s.Rate, s.Interval, s.Available)
+			}
+			restarted.TryWaitN(2)
+			if remaining, err := restarted.TryWait(); err == nil || remaining != time.Second {
+				t.Errorf("UnbufferedLimiter.TryWait() at the restored rate, want 1s remaining, got %v, %v", remaining, err)
+			}
+		})
+	}
+}
+
+func TestBufferedMarshal(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewBufferedLimiter(2, 1, time.Second, WithClock(clock))
+	defer limiter.Close()
+	limiter.TryWaitN(2)
+	data, err := limiter.MarshalJSON()
+	if err != nil {
+		t.Fatalf("BufferedLimiter.MarshalJSON(), want nil, got %v", err)
+	}
+
+	restarted := NewBufferedLimiter(5, 1, time.Minute, WithClock(clock))
+	defer restarted.Close()
+	if err := restarted.UnmarshalJSON(data); err != nil {
+		t.Fatalf("BufferedLimiter.UnmarshalJSON(), want nil, got %v", err)
+	}
+	if remaining, err := restarted.TryWait(); err == nil || remaining != time.Second {
+		t.Errorf("BufferedLimiter.TryWait() after UnmarshalJSON, want 1s remaining, got %v, %v", remaining, err)
+	}
+	clock.Advance(time.Second)
+	if _, err := restarted.TryWaitN(2); err != nil {
+		t.Errorf("BufferedLimiter.TryWaitN(2) after the interval, want nil, got %v", err)
+	}
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	valid, _ := NewUnbufferedLimiter(2, time.Second).MarshalBinary()
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: []byte{}},
+		{name: "Unknown version", data: append([]byte{stateVersion + 1}, valid[1:]...)},
+		{name: "Truncated", data: valid[:len(valid)-1]},
+		{name: "Trailing bytes", data: append(append([]byte{}, valid...), 0)},
+		{name: "Zero rate", data: []byte{stateVersion, 0, 2, 0}},
+		{name: "Zero interval", data: []byte{stateVersion, 1, 0, 0, 0}},
+		{name: "Index out of range", data: []byte{stateVersion, 1, 2, 1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewUnbufferedLimiter(1, time.Minute)
+			var configErr *LimiterConfigError
+			if err := limiter.UnmarshalBinary(tt.data); !errors.As(err, &configErr) {
+				t.Errorf("UnbufferedLimiter.UnmarshalBinary(%v), want LimiterConfigError, got %v", tt.data, err)
+			}
+			if s := limiter.Stats(); s.Rate != 1 || s.Interval != time.Minute {
+				t.Errorf("UnbufferedLimiter.Stats() after a failed UnmarshalBinary, want rate 1 and interval 1m, got %v and %v", s.Rate, s.Interval)
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewUnbufferedLimiter(2, time.Minute, WithClock(clock))
+	path := filepath.Join(t.TempDir(), "limiter.state")
+
+	if err := ReadCheckpoint(NewUnbufferedLimiter(1, time.Second), path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadCheckpoint() before the first checkpoint, want fs.ErrNotExist, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Checkpoint(ctx, limiter, path, time.Second, WithClock(clock))
+	}()
+
+	limiter.TryWait()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	clock.BlockUntil(1) // the next checkpoint is scheduled once the first one is written
+	restored := NewUnbufferedLimiter(1, time.Second, WithClock(clock))
+	if err := ReadCheckpoint(restored, path); err != nil {
+		t.Fatalf("ReadCheckpoint(), want nil, got %v", err)
+	}
+	if s := restored.Stats(); s.Rate != 2 || s.Available != 1 {
+		t.Errorf("UnbufferedLimiter.Stats() after the first checkpoint, want rate 2 with 1 available, got %v with %v", s.Rate, s.Available)
+	}
+
+	limiter.TryWait()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Checkpoint() after the context was cancelled, want nil, got %v", err)
+	}
+	if err := ReadCheckpoint(restored, path); err != nil {
+		t.Fatalf("ReadCheckpoint(), want nil, got %v", err)
+	}
+	if s := restored.Stats(); s.Available != 0 {
+		t.Errorf("UnbufferedLimiter.Stats() after the last checkpoint, want 0 available, got %v", s.Available)
+	}
+
+	if err := Checkpoint(ctx, limiter, path, 0); err == nil {
+		t.Errorf("Checkpoint() with period 0, want LimiterConfigError, got nil")
+	}
+}
@@ -0,0 +1,9 @@
+// Package ratehttp rate limits HTTP handlers with the limiters of the rate package.
+//
+// Middleware limits the requests a handler receives, per client when given a KeyFunc, rejecting
+// the requests over the limit with 429 Too Many Requests and a Retry-After header, or queueing
+// them until the limiter grants permission.
+//
+// Transport limits the requests an http.Client sends, per host when given Host as the KeyFunc,
+// and pauses when the server responds that it is receiving too many requests.
+package ratehttp
@@ -0,0 +1,184 @@
+package ratehttp
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// Limiters returns the limiter of a key, it is implemented by rate.KeyedLimiter. Use Single to
+// share one limiter between all keys.
+type Limiters interface {
+	// TryWait returns whether or not the limiter of the key granted permission.
+	TryWait(key string) (time.Duration, error)
+
+	// WaitContext returns when the limiter of the key grants permission or the context is done.
+	WaitContext(ctx context.Context, key string) error
+
+	// Get returns the limiter of the key, nil if there is none.
+	Get(key string) rate.Limiter
+}
+
+var _ Limiters = (*rate.KeyedLimiter)(nil)
+
+// single is a Limiters that returns the same limiter for every key
+type single struct {
+	limiter rate.Limiter
+}
+
+// Single returns Limiters that use the limiter for every key.
+func Single(limiter rate.Limiter) Limiters {
+	return &single{limiter: limiter}
+}
+
+func (s *single) TryWait(key string) (time.Duration, error) {
+	return s.limiter.TryWait()
+}
+
+func (s *single) WaitContext(ctx context.Context, key string) error {
+	return s.limiter.WaitContext(ctx)
+}
+
+func (s *single) Get(key string) rate.Limiter {
+	return s.limiter
+}
+
+// A KeyFunc returns the key of the limiter a request is limited by, for example the client IP or
+// API key.
+type KeyFunc func(r *http.Request) string
+
+// RemoteIP is a KeyFunc that limits by the IP address of the client. Behind a proxy the address is
+// the proxy's, use a KeyFunc that reads the header the proxy sets instead.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// An Option configures the Middleware or the Transport.
+type Option func(*options)
+
+// the configuration of the Middleware and the Transport
+type options struct {
+	queue   bool
+	maxWait time.Duration
+	clock   rate.Clock
+}
+
+// returns the options with the defaults for the ones not received
+func newOptions(opts []Option) *options {
+	o := &options{
+		queue:   false,
+		maxWait: 0,
+		clock:   systemClock{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithQueueing makes the Middleware wait for permission instead of rejecting the requests over
+// the limit, use it with a BufferedLimiter so the requests are served in order. A request waits
+// until the limiter grants permission, the client goes away, or maxWait passes if it is > 0.
+func WithQueueing(maxWait time.Duration) Option {
+	return func(o *options) {
+		o.queue = true
+		o.maxWait = maxWait
+	}
+}
+
+// WithClock sets the clock the Transport times the pauses of Retry-After with, the system clock is
+// used by default. A nil clock is ignored. The Middleware waits on the clocks of the limiters.
+func WithClock(clock rate.Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+// Middleware returns a middleware that limits the requests to a handler.
+//
+// Each request is limited by the limiter of the key keyFunc returns, all requests share the key ""
+// if keyFunc is nil. A request over the limit is rejected with 429 Too Many Requests and a
+// Retry-After header with the seconds until the limiter could grant permission. With WithQueueing
+// the request waits for permission instead, it is rejected with 429 if the buffer is full or it
+// waited longer than the maximum, and abandoned when the client goes away. A closed limiter
+// rejects requests with 503 Service Unavailable.
+//
+// If the limiter of the key reports its Stats, as the BufferedLimiter and UnbufferedLimiter do,
+// the responses include the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers.
+func Middleware(limiters Limiters, keyFunc KeyFunc, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := ""
+			if keyFunc != nil {
+				key = keyFunc(r)
+			}
+			var remaining time.Duration
+			var err error
+			if o.queue {
+				err = wait(r.Context(), limiters, key, o.maxWait)
+			} else {
+				remaining, err = limiters.TryWait(key)
+			}
+			reset := setRateLimitHeaders(w.Header(), limiters.Get(key))
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch err.(type) {
+			case *rate.LimiterOverLimitError, *rate.LimiterBufferFullError, *rate.LimiterWaitTimedOutError:
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, seconds(max(remaining, reset)))))
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			default:
+				if r.Context().Err() != nil { // the client went away, there is no one to respond to
+					return
+				}
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
+
+// waits for permission from the limiter of the key for at most maxWait if it is > 0
+func wait(ctx context.Context, limiters Limiters, key string, maxWait time.Duration) error {
+	if maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxWait)
+		defer cancel()
+	}
+	return limiters.WaitContext(ctx, key)
+}
+
+// sets the RateLimit headers if the limiter reports its stats and returns the time until the next
+// permission can be granted
+func setRateLimitHeaders(h http.Header, limiter rate.Limiter) time.Duration {
+	s, ok := limiter.(interface{ Stats() rate.Stats })
+	if !ok {
+		return 0
+	}
+	stats := s.Stats()
+	reset := time.Until(stats.NextAvailable)
+	h.Set("RateLimit-Limit", strconv.Itoa(stats.Rate))
+	h.Set("RateLimit-Remaining", strconv.Itoa(stats.Available))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(reset)))
+	return reset
+}
+
+// returns the duration in whole seconds rounded up, a duration <= 0 is 0 seconds
+func seconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
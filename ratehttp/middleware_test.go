@@ -0,0 +1,134 @@
+package ratehttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// a handler that responds with 200 OK
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestMiddleware(t *testing.T) {
+	limiter := rate.NewUnbufferedLimiter(2, time.Minute)
+	handler := Middleware(Single(limiter), nil)(ok)
+
+	tests := []struct {
+		name          string
+		wantStatus    int
+		wantRemaining string
+	}{
+		{name: "First request", wantStatus: http.StatusOK, wantRemaining: "1"},
+		{name: "Second request", wantStatus: http.StatusOK, wantRemaining: "0"},
+		{name: "Over the limit", wantStatus: http.StatusTooManyRequests, wantRemaining: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Middleware status, want %v, got %v", tt.wantStatus, rec.Code)
+			}
+			if got := rec.Header().Get("RateLimit-Limit"); got != "2" {
+				t.Errorf("Middleware RateLimit-Limit, want 2, got %q", got)
+			}
+			if got := rec.Header().Get("RateLimit-Remaining"); got != tt.wantRemaining {
+				t.Errorf("Middleware RateLimit-Remaining, want %v, got %q", tt.wantRemaining, got)
+			}
+			if tt.wantStatus != http.StatusTooManyRequests {
+				return
+			}
+			retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+			if err != nil || retryAfter < 59 || retryAfter > 60 {
+				t.Errorf("Middleware Retry-After, want about 60, got %q", rec.Header().Get("Retry-After"))
+			}
+			if got := rec.Header().Get("RateLimit-Reset"); got != rec.Header().Get("Retry-After") {
+				t.Errorf("Middleware RateLimit-Reset, want the Retry-After %v, got %q", retryAfter, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareKeyFunc(t *testing.T) {
+	limiters := rate.NewKeyedLimiter(func(key string) rate.Limiter {
+		return rate.NewUnbufferedLimiter(1, time.Minute)
+	}, time.Minute, 10)
+	defer limiters.Close()
+	handler := Middleware(limiters, RemoteIP)(ok)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantStatus int
+	}{
+		{name: "First client", remoteAddr: "192.0.2.1:1234", wantStatus: http.StatusOK},
+		{name: "Second client", remoteAddr: "192.0.2.2:1234", wantStatus: http.StatusOK},
+		{name: "First client other port", remoteAddr: "192.0.2.1:4321", wantStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Middleware status, want %v, got %v", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareQueueing(t *testing.T) {
+	limiter := rate.NewBufferedLimiter(1, 1, time.Millisecond*200)
+	defer limiter.Close()
+	limiter.TryWait()
+
+	tests := []struct {
+		name       string
+		maxWait    time.Duration
+		cancel     bool
+		wantStatus int
+	}{
+		{name: "Waits for permission", maxWait: 0, wantStatus: http.StatusOK},
+		{name: "Waits longer than the maximum", maxWait: time.Millisecond * 50, wantStatus: http.StatusTooManyRequests},
+		{name: "Client went away", maxWait: 0, cancel: true, wantStatus: http.StatusOK}, // nothing written
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Middleware(Single(limiter), nil, WithQueueing(tt.maxWait))(ok)
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.cancel {
+				cancel()
+			}
+			defer cancel()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Middleware status, want %v, got %v", tt.wantStatus, rec.Code)
+			}
+			if tt.cancel && rec.Body.Len() != 0 {
+				t.Errorf("Middleware body after the client went away, want empty, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareClosed(t *testing.T) {
+	limiter := rate.NewUnbufferedLimiter(1, time.Second)
+	limiter.Close()
+	rec := httptest.NewRecorder()
+	Middleware(Single(limiter), nil)(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Middleware status with a closed limiter, want %v, got %v", http.StatusServiceUnavailable, rec.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package ratehttp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// A Transport is an http.RoundTripper that waits for permission from a limiter before sending each
+// request.
+//
+// When the server responds with 429 Too Many Requests, or 503 Service Unavailable, and a
+// Retry-After header the Transport pauses the requests of the same key until the time the server
+// asked for has passed.
+type Transport struct {
+	base     http.RoundTripper
+	limiters Limiters
+	keyFunc  KeyFunc
+	clock    rate.Clock
+	mu       *sync.Mutex
+	paused   map[string]time.Time
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport returns a new Transport that sends the requests with base once the limiter of the
+// key keyFunc returns grants permission.
+//
+// If base is nil http.DefaultTransport is used, and if keyFunc is nil all requests share the key
+// "". Use Host as the keyFunc to limit every host separately. The options configure the rest of the
+// Transport, such as the clock it times the pauses with.
+func NewTransport(base http.RoundTripper, limiters Limiters, keyFunc KeyFunc, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	o := newOptions(opts)
+	return &Transport{
+		base:     base,
+		limiters: limiters,
+		keyFunc:  keyFunc,
+		clock:    o.clock,
+		mu:       &sync.Mutex{},
+		paused:   map[string]time.Time{},
+	}
+}
+
+// Host is a KeyFunc that limits by the host, including the port, the request is sent to.
+func Host(r *http.Request) string {
+	return r.URL.Host
+}
+
+// RoundTrip waits until the key of the request is no longer paused and its limiter grants
+// permission, then sends the request. The wait ends with the context of the request, returning the
+// error of the limiter.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := ""
+	if t.keyFunc != nil {
+		key = t.keyFunc(r)
+	}
+	if err := t.waitPaused(r.Context(), key); err != nil {
+		closeBody(r)
+		return nil, err
+	}
+	if err := t.limiters.WaitContext(r.Context(), key); err != nil {
+		closeBody(r)
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), t.clock.Now()); ok {
+			t.Pause(key, d)
+		}
+	}
+	return resp, nil
+}
+
+// Pause holds back the requests of the key for the duration d, extending the current pause if it
+// ends sooner.
+func (t *Transport) Pause(key string, d time.Duration) {
+	now := t.clock.Now()
+	until := now.Add(d)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// remove the pauses that ended so keys that are no longer used don't stay in the map
+	for k, end := range t.paused {
+		if !now.Before(end) {
+			delete(t.paused, k)
+		}
+	}
+	if until.After(now) && until.After(t.paused[key]) {
+		t.paused[key] = until
+	}
+}
+
+// waits until the key is no longer paused or the context is done
+func (t *Transport) waitPaused(ctx context.Context, key string) error {
+	for {
+		t.mu.Lock()
+		until, ok := t.paused[key]
+		now := t.clock.Now()
+		if ok && !now.Before(until) {
+			delete(t.paused, key)
+			ok = false
+		}
+		t.mu.Unlock()
+		if !ok {
+			return nil
+		}
+		c, stop := t.clock.NewTimer(until.Sub(now))
+		select {
+		case <-c:
+		case <-ctx.Done():
+			stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// the system clock
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// closes the body of a request that is not sent, as a RoundTripper must
+func closeBody(r *http.Request) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+}
+
+// returns the duration a Retry-After header asks to wait, given in seconds or as an HTTP date,
+// and true if the header is valid
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return date.Sub(now), true
+}
@@ -0,0 +1,194 @@
+package ratehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestTransport(t *testing.T) {
+	server := httptest.NewServer(ok)
+	defer server.Close()
+	other := httptest.NewServer(ok)
+	defer other.Close()
+
+	tests := []struct {
+		name    string
+		keyFunc KeyFunc
+		urls    []string
+		minTime time.Duration
+		maxTime time.Duration
+	}{
+		{
+			name:    "Same host",
+			keyFunc: Host,
+			urls:    []string{server.URL, server.URL},
+			minTime: time.Millisecond * 150,
+			maxTime: time.Millisecond * 400,
+		},
+		{
+			name:    "Per host",
+			keyFunc: Host,
+			urls:    []string{server.URL, other.URL},
+			minTime: 0,
+			maxTime: time.Millisecond * 150,
+		},
+		{
+			name:    "Shared key",
+			keyFunc: nil,
+			urls:    []string{server.URL, other.URL},
+			minTime: time.Millisecond * 150,
+			maxTime: time.Millisecond * 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiters := rate.NewKeyedLimiter(func(key string) rate.Limiter {
+				return rate.NewUnbufferedLimiter(1, time.Millisecond*200)
+			}, time.Minute, 10)
+			defer limiters.Close()
+			client := &http.Client{Transport: NewTransport(nil, limiters, tt.keyFunc)}
+
+			start := time.Now()
+			for _, url := range tt.urls {
+				resp, err := client.Get(url)
+				if err != nil {
+					t.Fatalf("Transport.RoundTrip(), want nil, got %v", err)
+				}
+				resp.Body.Close()
+			}
+			if elapsed := time.Since(start); elapsed < tt.minTime || elapsed > tt.maxTime {
+				t.Errorf("Transport.RoundTrip() time, want between %v and %v, got %v", tt.minTime, tt.maxTime, elapsed)
+			}
+		})
+	}
+}
+
+func TestTransportRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	limiter := rate.NewUnbufferedLimiter(10, time.Second)
+	client := &http.Client{Transport: NewTransport(nil, Single(limiter), nil)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Transport.RoundTrip(), want nil, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Transport.RoundTrip() status, want %v, got %v", http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	// the pause ends with the context of the request
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Transport.RoundTrip() while paused, want context.DeadlineExceeded, got %v", err)
+	}
+
+	start := time.Now()
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Transport.RoundTrip() after the pause, want nil, got %v", err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < time.Millisecond*700 {
+		t.Errorf("Transport.RoundTrip() after the pause, want to wait about 1s, got %v", elapsed)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("server requests, want 2, got %v", got)
+	}
+}
+
+func TestTransportPauseClock(t *testing.T) {
+	server := httptest.NewServer(ok)
+	defer server.Close()
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := rate.NewUnbufferedLimiter(10, time.Second, rate.WithClock(clock))
+	transport := NewTransport(nil, Single(limiter), nil, WithClock(clock))
+	client := &http.Client{Transport: transport}
+
+	transport.Pause("", time.Minute)
+	done := make(chan error)
+	go func() {
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		done <- err
+	}()
+	clock.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("Transport.RoundTrip() while paused, want to wait, got %v", err)
+	default:
+	}
+	clock.Advance(time.Minute)
+	if err := <-done; err != nil {
+		t.Errorf("Transport.RoundTrip() after the pause, want nil, got %v", err)
+	}
+}
+
+func TestTransportPausePrune(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	transport := NewTransport(nil, Single(rate.NewUnbufferedLimiter(1, time.Second)), Host, WithClock(clock))
+	for i := 0; i < 10; i++ {
+		transport.Pause(strconv.Itoa(i), time.Second*time.Duration(i+1))
+	}
+	transport.Pause("expired", 0)
+	clock.Advance(time.Second * 5)
+	transport.Pause("new", time.Second)
+
+	// the keys whose pause ended are removed without another request for them
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+	if got := len(transport.paused); got != 6 {
+		t.Errorf("Transport paused keys, want 6, got %v", got)
+	}
+	if _, ok := transport.paused["4"]; ok {
+		t.Errorf("Transport paused keys, want the ended pause of 4 removed, got it kept")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "Seconds", value: "120", want: time.Minute * 2, wantOk: true},
+		{name: "HTTP date", value: "Mon, 01 Jan 2024 00:00:30 GMT", want: time.Second * 30, wantOk: true},
+		{name: "Empty", value: "", want: 0, wantOk: false},
+		{name: "Negative", value: "-1", want: 0, wantOk: false},
+		{name: "Invalid", value: "soon", want: 0, wantOk: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotOk := parseRetryAfter(tt.value, now)
+			if got != tt.want || gotOk != tt.wantOk {
+				t.Errorf("parseRetryAfter(%q), want %v %v, got %v %v", tt.value, tt.want, tt.wantOk, got, gotOk)
+			}
+		})
+	}
+}
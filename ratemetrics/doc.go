@@ -0,0 +1,8 @@
+// Package ratemetrics exports metrics about the limiters of the rate package.
+//
+// A limiter registered with a Registry under a name is wrapped so the outcome and the wait time of
+// every request is counted. The Registry exports the grants, the denials by error type, a histogram
+// of the wait times and, for limiters with a buffer, the number of queued requests, both as an
+// expvar.Var and over HTTP in the Prometheus text format. Nothing outside the standard library is
+// needed.
+package ratemetrics
@@ -0,0 +1,205 @@
+package ratemetrics
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// the reasons a request is denied, used as the label of the denial counters
+const (
+	reasonTimedOut   = "timed_out"
+	reasonBufferFull = "buffer_full"
+	reasonOverLimit  = "over_limit"
+	reasonClosed     = "closed"
+	reasonTooLarge   = "too_large"
+	reasonCanceled   = "canceled"
+	reasonOther      = "other"
+)
+
+// the denial reasons in the order they are exported
+var reasons = []string{
+	reasonTimedOut,
+	reasonBufferFull,
+	reasonOverLimit,
+	reasonClosed,
+	reasonTooLarge,
+	reasonCanceled,
+	reasonOther,
+}
+
+// the upper bounds in seconds of the buckets of the wait time histogram
+var buckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// A Limiter is a rate.Limiter that counts the outcome of every request and how long the blocking
+// requests waited before passing them on to the limiter it wraps. Limiters are created by
+// Registry.Register.
+type Limiter struct {
+	name    string
+	limiter rate.Limiter
+	grants  atomic.Uint64
+	denials map[string]*atomic.Uint64
+	waits   *histogram
+}
+
+var _ rate.Limiter = (*Limiter)(nil)
+
+// returns a new Limiter wrapping the limiter
+func newLimiter(name string, limiter rate.Limiter) *Limiter {
+	denials := make(map[string]*atomic.Uint64, len(reasons))
+	for _, reason := range reasons {
+		denials[reason] = &atomic.Uint64{}
+	}
+	return &Limiter{
+		name:    name,
+		limiter: limiter,
+		denials: denials,
+		waits:   newHistogram(buckets),
+	}
+}
+
+// Name returns the name the Limiter was registered under.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Unwrap returns the limiter the Limiter wraps.
+func (l *Limiter) Unwrap() rate.Limiter {
+	return l.limiter
+}
+
+// Wait calls Wait on the wrapped limiter and records the outcome and the time waited.
+func (l *Limiter) Wait(timeout *time.Duration) error {
+	start := time.Now()
+	err := l.limiter.Wait(timeout)
+	l.recordWait(start, err)
+	return err
+}
+
+// WaitContext calls WaitContext on the wrapped limiter and records the outcome and the time
+// waited.
+func (l *Limiter) WaitContext(ctx context.Context) error {
+	start := time.Now()
+	err := l.limiter.WaitContext(ctx)
+	l.recordWait(start, err)
+	return err
+}
+
+// WaitN calls WaitN on the wrapped limiter and records the outcome and the time waited.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	start := time.Now()
+	err := l.limiter.WaitN(ctx, n)
+	l.recordWait(start, err)
+	return err
+}
+
+// TryWait calls TryWait on the wrapped limiter and records the outcome.
+func (l *Limiter) TryWait() (time.Duration, error) {
+	remaining, err := l.limiter.TryWait()
+	l.record(err)
+	return remaining, err
+}
+
+// TryWaitN calls TryWaitN on the wrapped limiter and records the outcome.
+func (l *Limiter) TryWaitN(n int) (time.Duration, error) {
+	remaining, err := l.limiter.TryWaitN(n)
+	l.record(err)
+	return remaining, err
+}
+
+// Close closes the wrapped limiter. The Limiter stays registered so its final metrics are still
+// exported, use Registry.Unregister to remove it.
+func (l *Limiter) Close() error {
+	return l.limiter.Close()
+}
+
+// returns the number of requests waiting in the buffer of the wrapped limiter and true, or false
+// if the wrapped limiter has no buffer or does not report it
+func (l *Limiter) queueDepth() (int, bool) {
+	s, ok := l.limiter.(interface{ Stats() rate.Stats })
+	if !ok {
+		return 0, false
+	}
+	stats := s.Stats()
+	return stats.Queued, stats.Capacity > 0
+}
+
+// records the outcome of a blocking request and the time it waited
+func (l *Limiter) recordWait(start time.Time, err error) {
+	l.waits.observe(time.Since(start).Seconds())
+	l.record(err)
+}
+
+// records the outcome of a request given the error it returned
+func (l *Limiter) record(err error) {
+	if err == nil {
+		l.grants.Add(1)
+		return
+	}
+	l.denials[reason(err)].Add(1)
+}
+
+// returns the reason a request was denied given the error it returned
+func reason(err error) string {
+	switch err.(type) {
+	case *rate.LimiterWaitTimedOutError:
+		return reasonTimedOut
+	case *rate.LimiterBufferFullError:
+		return reasonBufferFull
+	case *rate.LimiterOverLimitError:
+		return reasonOverLimit
+	case *rate.LimiterClosedError:
+		return reasonClosed
+	case *rate.LimiterRequestTooLargeError:
+		return reasonTooLarge
+	}
+	if err == context.Canceled {
+		return reasonCanceled
+	}
+	return reasonOther
+}
+
+// a histogram with fixed buckets that is safe for concurrent use
+type histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // the count of each bucket followed by the count above the last bound
+	sum    atomic.Uint64   // the float64 bits of the sum
+}
+
+// returns a new histogram with the given bucket upper bounds in increasing order
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Uint64, len(bounds)+1),
+	}
+}
+
+// records a value
+func (h *histogram) observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// returns the cumulative count of each bucket, the total count and the sum of the values
+func (h *histogram) snapshot() ([]uint64, uint64, float64) {
+	cumulative := make([]uint64, len(h.bounds))
+	var total uint64
+	for i := range h.bounds {
+		total += h.counts[i].Load()
+		cumulative[i] = total
+	}
+	total += h.counts[len(h.bounds)].Load()
+	return cumulative, total, math.Float64frombits(h.sum.Load())
+}
@@ -0,0 +1,94 @@
+package ratemetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestLimiterRecord(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	l := newLimiter("test", rate.NewUnbufferedLimiter(1, time.Second, rate.WithClock(clock)))
+
+	l.TryWait()
+	l.TryWait()
+	l.TryWaitN(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.WaitContext(ctx)
+	timeout := time.Duration(0)
+	l.Wait(&timeout)
+	l.Close()
+	l.TryWait()
+
+	tests := []struct {
+		reason string
+		want   uint64
+	}{
+		{reason: reasonOverLimit, want: 1},
+		{reason: reasonTooLarge, want: 1},
+		{reason: reasonCanceled, want: 1},
+		{reason: reasonTimedOut, want: 1},
+		{reason: reasonClosed, want: 1},
+		{reason: reasonBufferFull, want: 0},
+		{reason: reasonOther, want: 0},
+	}
+
+	if got := l.grants.Load(); got != 1 {
+		t.Errorf("Limiter grants, want 1, got %v", got)
+	}
+	for _, tt := range tests {
+		if got := l.denials[tt.reason].Load(); got != tt.want {
+			t.Errorf("Limiter denials %v, want %v, got %v", tt.reason, tt.want, got)
+		}
+	}
+	if _, count, _ := l.waits.snapshot(); count != 2 {
+		t.Errorf("Limiter wait time count, want 2, got %v", count)
+	}
+}
+
+func TestReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "Timed out", err: &rate.LimiterWaitTimedOutError{}, want: reasonTimedOut},
+		{name: "Buffer full", err: &rate.LimiterBufferFullError{}, want: reasonBufferFull},
+		{name: "Over limit", err: &rate.LimiterOverLimitError{}, want: reasonOverLimit},
+		{name: "Closed", err: &rate.LimiterClosedError{}, want: reasonClosed},
+		{name: "Too large", err: &rate.LimiterRequestTooLargeError{}, want: reasonTooLarge},
+		{name: "Canceled", err: context.Canceled, want: reasonCanceled},
+		{name: "Unknown", err: errors.New("unknown"), want: reasonOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reason(tt.err); got != tt.want {
+				t.Errorf("reason(%v), want %v, got %v", tt.err, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{1, 2})
+	for _, v := range []float64{0.5, 1, 1.5, 3} {
+		h.observe(v)
+	}
+
+	cumulative, count, sum := h.snapshot()
+	if cumulative[0] != 2 || cumulative[1] != 3 {
+		t.Errorf("histogram buckets, want [2 3], got %v", cumulative)
+	}
+	if count != 4 {
+		t.Errorf("histogram count, want 4, got %v", count)
+	}
+	if sum != 6 {
+		t.Errorf("histogram sum, want 6, got %v", sum)
+	}
+}
@@ -0,0 +1,191 @@
+package ratemetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// A Registry holds named limiters and exports their metrics. It implements expvar.Var and
+// http.Handler.
+type Registry struct {
+	mu       *sync.Mutex
+	limiters map[string]*Limiter
+}
+
+var (
+	_ expvar.Var   = (*Registry)(nil)
+	_ http.Handler = (*Registry)(nil)
+)
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		mu:       &sync.Mutex{},
+		limiters: map[string]*Limiter{},
+	}
+}
+
+// Register registers the limiter under the name and returns a Limiter wrapping it.
+//
+// Only the requests made through the returned Limiter are counted, so it should be used in place
+// of the limiter. An error is returned if the name is empty or already registered.
+func (r *Registry) Register(name string, limiter rate.Limiter) (*Limiter, error) {
+	if name == "" {
+		return nil, fmt.Errorf("ratemetrics: empty limiter name")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.limiters[name]; ok {
+		return nil, fmt.Errorf("ratemetrics: limiter %q already registered", name)
+	}
+	l := newLimiter(name, limiter)
+	r.limiters[name] = l
+	return l, nil
+}
+
+// Unregister removes the limiter registered under the name, its metrics are no longer exported.
+// Unregister does not close the limiter.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.limiters, name)
+}
+
+// Publish publishes the Registry with the expvar package under the name, so its metrics are
+// served as JSON by the expvar handler. Like expvar.Publish it panics if the name is already in use.
+func (r *Registry) Publish(name string) {
+	expvar.Publish(name, r)
+}
+
+// returns the registered limiters sorted by name
+func (r *Registry) sorted() []*Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limiters := make([]*Limiter, 0, len(r.limiters))
+	for _, l := range r.limiters {
+		limiters = append(limiters, l)
+	}
+	sort.Slice(limiters, func(i, j int) bool {
+		return limiters[i].name < limiters[j].name
+	})
+	return limiters
+}
+
+// the JSON form of the metrics of a limiter
+type limiterVar struct {
+	Grants      uint64            `json:"grants"`
+	Denials     map[string]uint64 `json:"denials"`
+	WaitSeconds waitVar           `json:"wait_seconds"`
+	QueueDepth  *int              `json:"queue_depth,omitempty"`
+}
+
+// the JSON form of the wait time histogram, the buckets are cumulative and keyed by upper bound
+type waitVar struct {
+	Count   uint64            `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets map[string]uint64 `json:"buckets"`
+}
+
+// String returns the metrics of the registered limiters as a JSON object keyed by name, it
+// implements expvar.Var.
+func (r *Registry) String() string {
+	vars := map[string]limiterVar{}
+	for _, l := range r.sorted() {
+		v := limiterVar{
+			Grants:  l.grants.Load(),
+			Denials: make(map[string]uint64, len(reasons)),
+		}
+		for _, reason := range reasons {
+			v.Denials[reason] = l.denials[reason].Load()
+		}
+		cumulative, count, sum := l.waits.snapshot()
+		v.WaitSeconds = waitVar{
+			Count:   count,
+			Sum:     sum,
+			Buckets: make(map[string]uint64, len(cumulative)),
+		}
+		for i, bound := range l.waits.bounds {
+			v.WaitSeconds.Buckets[formatFloat(bound)] = cumulative[i]
+		}
+		if depth, ok := l.queueDepth(); ok {
+			v.QueueDepth = &depth
+		}
+		vars[l.name] = v
+	}
+	b, err := json.Marshal(vars)
+	if err != nil { // the values are all numbers and strings so this can't happen
+		return "{}"
+	}
+	return string(b)
+}
+
+// ServeHTTP writes the metrics of the registered limiters in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the metrics of the registered limiters to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	limiters := r.sorted()
+	var b strings.Builder
+
+	b.WriteString("# HELP rate_limiter_grants_total Requests granted permission.\n")
+	b.WriteString("# TYPE rate_limiter_grants_total counter\n")
+	for _, l := range limiters {
+		fmt.Fprintf(&b, "rate_limiter_grants_total{limiter=%s} %d\n", quote(l.name), l.grants.Load())
+	}
+
+	b.WriteString("# HELP rate_limiter_denials_total Requests denied permission by reason.\n")
+	b.WriteString("# TYPE rate_limiter_denials_total counter\n")
+	for _, l := range limiters {
+		for _, reason := range reasons {
+			fmt.Fprintf(&b, "rate_limiter_denials_total{limiter=%s,reason=%s} %d\n", quote(l.name), quote(reason), l.denials[reason].Load())
+		}
+	}
+
+	b.WriteString("# HELP rate_limiter_wait_seconds Time blocking requests waited for permission.\n")
+	b.WriteString("# TYPE rate_limiter_wait_seconds histogram\n")
+	for _, l := range limiters {
+		cumulative, count, sum := l.waits.snapshot()
+		for i, bound := range l.waits.bounds {
+			fmt.Fprintf(&b, "rate_limiter_wait_seconds_bucket{limiter=%s,le=%s} %d\n", quote(l.name), quote(formatFloat(bound)), cumulative[i])
+		}
+		fmt.Fprintf(&b, "rate_limiter_wait_seconds_bucket{limiter=%s,le=\"+Inf\"} %d\n", quote(l.name), count)
+		fmt.Fprintf(&b, "rate_limiter_wait_seconds_sum{limiter=%s} %s\n", quote(l.name), formatFloat(sum))
+		fmt.Fprintf(&b, "rate_limiter_wait_seconds_count{limiter=%s} %d\n", quote(l.name), count)
+	}
+
+	b.WriteString("# HELP rate_limiter_queue_depth Requests waiting in the buffer.\n")
+	b.WriteString("# TYPE rate_limiter_queue_depth gauge\n")
+	for _, l := range limiters {
+		if depth, ok := l.queueDepth(); ok {
+			fmt.Fprintf(&b, "rate_limiter_queue_depth{limiter=%s} %d\n", quote(l.name), depth)
+		}
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// returns the label value quoted and escaped as the Prometheus text format expects
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
+
+// returns the float formatted the shortest way that parses back to the same value
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
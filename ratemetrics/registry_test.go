@@ -0,0 +1,94 @@
+package ratemetrics
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "api", wantErr: false},
+		{name: "api", wantErr: true},
+		{name: "", wantErr: true},
+		{name: "db", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		l, err := r.Register(tt.name, rate.NewUnbufferedLimiter(1, time.Second))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Registry.Register(%q), wantErr %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if err == nil && l.Name() != tt.name {
+			t.Errorf("Registry.Register(%q).Name(), want %q, got %q", tt.name, tt.name, l.Name())
+		}
+	}
+
+	r.Unregister("api")
+	if _, err := r.Register("api", rate.NewUnbufferedLimiter(1, time.Second)); err != nil {
+		t.Errorf("Registry.Register(\"api\") after Unregister, want nil, got %v", err)
+	}
+}
+
+func TestRegistryString(t *testing.T) {
+	r := NewRegistry()
+	buffered := rate.NewBufferedLimiter(1, 1, time.Second)
+	defer buffered.Close()
+	b, _ := r.Register("buffered", buffered)
+	u, _ := r.Register("unbuffered", rate.NewUnbufferedLimiter(1, time.Second))
+	b.TryWait()
+	u.TryWait()
+	u.TryWait()
+
+	var got map[string]limiterVar
+	if err := json.Unmarshal([]byte(r.String()), &got); err != nil {
+		t.Fatalf("Registry.String(), want JSON, got %v", err)
+	}
+	if got["buffered"].Grants != 1 || got["buffered"].QueueDepth == nil {
+		t.Errorf("Registry.String() buffered, want 1 grant and a queue depth, got %+v", got["buffered"])
+	}
+	if got["unbuffered"].Denials[reasonOverLimit] != 1 {
+		t.Errorf("Registry.String() unbuffered, want 1 over limit denial, got %+v", got["unbuffered"])
+	}
+	if got["unbuffered"].QueueDepth != nil {
+		t.Errorf("Registry.String() unbuffered, want no queue depth, got %v", *got["unbuffered"].QueueDepth)
+	}
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	buffered := rate.NewBufferedLimiter(1, 1, time.Second)
+	defer buffered.Close()
+	l, _ := r.Register(`say "hi"`, buffered)
+	l.TryWait()
+	l.Wait(nil)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	tests := []string{
+		"# TYPE rate_limiter_grants_total counter\n",
+		`rate_limiter_grants_total{limiter="say \"hi\""} 2` + "\n",
+		`rate_limiter_denials_total{limiter="say \"hi\"",reason="buffer_full"} 0` + "\n",
+		`rate_limiter_wait_seconds_bucket{limiter="say \"hi\"",le="+Inf"} 1` + "\n",
+		`rate_limiter_wait_seconds_count{limiter="say \"hi\""} 1` + "\n",
+		`rate_limiter_queue_depth{limiter="say \"hi\""} 0` + "\n",
+	}
+	for _, want := range tests {
+		if !strings.Contains(body, want) {
+			t.Errorf("Registry.ServeHTTP(), want line %q, got\n%v", want, body)
+		}
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Registry.ServeHTTP() Content-Type, want text/plain, got %v", got)
+	}
+}
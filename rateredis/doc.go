@@ -0,0 +1,8 @@
+// Package rateredis implements the rate.Store interface on top of a server speaking the Redis
+// protocol (RESP), such as Redis, Valkey or KeyDB, so a rate.DistributedLimiter can share its
+// limit between processes.
+//
+// The Store only uses the SET, GET, INCRBY, WATCH, UNWATCH, MULTI and EXEC commands, plus AUTH and
+// SELECT when configured, and talks to the server over plain TCP without any dependency outside
+// the standard library.
+package rateredis
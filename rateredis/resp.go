@@ -0,0 +1,184 @@
+package rateredis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ServerError is an error reply of the server.
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return "rateredis: " + e.Message
+}
+
+// a connection to the server
+type conn struct {
+	netConn net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+}
+
+// returns a new conn over the network connection
+func newConn(netConn net.Conn) *conn {
+	return &conn{
+		netConn: netConn,
+		r:       bufio.NewReader(netConn),
+		w:       bufio.NewWriter(netConn),
+	}
+}
+
+// sets the deadline of the next reads and writes to the deadline of the context, clearing the
+// deadline of the previous ones if the context has none
+func (c *conn) setDeadline(ctx context.Context) error {
+	deadline, _ := ctx.Deadline()
+	return c.netConn.SetDeadline(deadline)
+}
+
+// sends the commands in one write, pipelining them, and returns their replies in order. Error
+// replies are returned as a *ServerError in the replies, the error is only for the connection.
+func (c *conn) do(ctx context.Context, commands ...[]string) ([]any, error) {
+	if err := c.setDeadline(ctx); err != nil {
+		return nil, err
+	}
+	// unblock the reads and writes once the context is done
+	stop := context.AfterFunc(ctx, func() {
+		c.netConn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+	replies, err := c.roundTrip(commands)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// the deadline of the connection may pass just before the context notices
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	return replies, err
+}
+
+// sends the commands and reads their replies
+func (c *conn) roundTrip(commands [][]string) ([]any, error) {
+	for _, args := range commands {
+		writeCommand(c.w, args)
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]any, len(commands))
+	for i := range commands {
+		reply, err := readReply(c.r)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// writes the command as an array of bulk strings
+func writeCommand(w *bufio.Writer, args []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// reads a reply, returning a string for simple and bulk strings, an int64 for integers, a []any
+// for arrays, nil for nil bulk strings and arrays, and a *ServerError for errors
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("rateredis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return &ServerError{Message: line[1:]}, nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, length+2) // the string followed by \r\n
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:length]), nil
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if length < 0 {
+			return nil, nil
+		}
+		array := make([]any, length)
+		for i := range array {
+			if array[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, fmt.Errorf("rateredis: unexpected reply %q", line)
+}
+
+// reads a line without the trailing \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("rateredis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+// returns the reply as an error if it is an error reply
+func replyError(reply any) error {
+	if err, ok := reply.(*ServerError); ok {
+		return err
+	}
+	return nil
+}
+
+// returns the reply as an integer, parsing bulk strings, with nil as 0
+func replyInt(reply any) (int64, error) {
+	switch v := reply.(type) {
+	case nil:
+		return 0, nil
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	case *ServerError:
+		return 0, v
+	}
+	return 0, fmt.Errorf("rateredis: unexpected reply %v", reply)
+}
+
+// returns the duration in milliseconds as a command argument, at least 1
+func milliseconds(d time.Duration) string {
+	return strconv.FormatInt(max(d.Milliseconds(), 1), 10)
+}
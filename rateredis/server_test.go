@@ -0,0 +1,214 @@
+package rateredis
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// a stand in for a Redis server implementing the commands the Store uses, in memory
+type testServer struct {
+	listener net.Listener
+	password string
+	mu       *sync.Mutex
+	values   map[string]testValue
+	versions map[string]int // incremented on every change of a key, for WATCH
+	commands []string       // the names of the commands received
+}
+
+// a value of the testServer and when it expires, never if zero
+type testValue struct {
+	value   string
+	expires time.Time
+}
+
+// starts a testServer on a local port, it is closed when the test ends
+func newTestServer(t *testing.T, password string) *testServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(), want nil, got %v", err)
+	}
+	s := &testServer{
+		listener: listener,
+		password: password,
+		mu:       &sync.Mutex{},
+		values:   map[string]testValue{},
+		versions: map[string]int{},
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+// the address of the testServer
+func (s *testServer) addr() string {
+	return s.listener.Addr().String()
+}
+
+// returns the number of commands received with the name
+func (s *testServer) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, command := range s.commands {
+		if command == name {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *testServer) serve() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(netConn)
+	}
+}
+
+// the state of a client connection
+type testSession struct {
+	authenticated bool
+	watched       map[string]int
+	queued        [][]string // nil when not in a transaction
+}
+
+func (s *testServer) handle(netConn net.Conn) {
+	defer netConn.Close()
+	r := bufio.NewReader(netConn)
+	w := bufio.NewWriter(netConn)
+	session := &testSession{authenticated: s.password == "", watched: map[string]int{}}
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		array, _ := reply.([]any)
+		args := make([]string, len(array))
+		for i, arg := range array {
+			args[i], _ = arg.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+		w.WriteString(s.exec(session, args))
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// runs the command and returns the reply in the protocol format
+func (s *testServer) exec(session *testSession, args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name := strings.ToUpper(args[0])
+	s.commands = append(s.commands, name)
+	if name == "AUTH" {
+		if len(args) != 2 || args[1] != s.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		session.authenticated = true
+		return "+OK\r\n"
+	}
+	if !session.authenticated {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+	if session.queued != nil && name != "EXEC" {
+		session.queued = append(session.queued, args)
+		return "+QUEUED\r\n"
+	}
+	switch name {
+	case "MULTI":
+		session.queued = [][]string{}
+		return "+OK\r\n"
+	case "EXEC":
+		queued := session.queued
+		session.queued = nil
+		watched := session.watched
+		session.watched = map[string]int{}
+		for key, version := range watched {
+			s.expire(key)
+			if s.versions[key] != version {
+				return "*-1\r\n"
+			}
+		}
+		replies := "*" + strconv.Itoa(len(queued)) + "\r\n"
+		for _, args := range queued {
+			replies += s.run(args)
+		}
+		return replies
+	case "WATCH":
+		for _, key := range args[1:] {
+			s.expire(key)
+			session.watched[key] = s.versions[key]
+		}
+		return "+OK\r\n"
+	case "UNWATCH":
+		session.watched = map[string]int{}
+		return "+OK\r\n"
+	}
+	return s.run(args)
+}
+
+// runs a command that can be part of a transaction. Must be called while holding the lock.
+func (s *testServer) run(args []string) string {
+	if len(args) > 1 {
+		s.expire(args[1])
+	}
+	switch strings.ToUpper(args[0]) {
+	case "SELECT", "PING":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := s.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(v.value)) + "\r\n" + v.value + "\r\n"
+	case "SET":
+		key, v := args[1], testValue{value: args[2]}
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if _, ok := s.values[key]; ok {
+					return "$-1\r\n"
+				}
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(args[i])
+				v.expires = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+		}
+		s.values[key] = v
+		s.versions[key]++
+		return "+OK\r\n"
+	case "INCRBY":
+		key := args[1]
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return "-ERR value is not an integer or out of range\r\n"
+		}
+		v := s.values[key]
+		current, _ := strconv.ParseInt(v.value, 10, 64)
+		v.value = strconv.FormatInt(current+n, 10)
+		s.values[key] = v
+		s.versions[key]++
+		return ":" + v.value + "\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+// removes the key if it expired, which counts as a change. Must be called while holding the lock.
+func (s *testServer) expire(key string) {
+	v, ok := s.values[key]
+	if ok && !v.expires.IsZero() && !time.Now().Before(v.expires) {
+		delete(s.values, key)
+		s.versions[key]++
+	}
+}
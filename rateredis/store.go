@@ -0,0 +1,237 @@
+package rateredis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+// A Store is a rate.Store that keeps the counters on a server speaking the Redis protocol. It is
+// safe for concurrent use and keeps a pool of connections to the server.
+type Store struct {
+	addr     string
+	password string
+	db       int
+	dialer   *net.Dialer
+	mu       *sync.Mutex
+	idle     []*conn
+	poolSize int
+	closed   bool
+}
+
+var _ rate.Store = (*Store)(nil)
+
+// An Option configures the Store.
+type Option func(*Store)
+
+// WithPassword sets the password sent with AUTH on every new connection.
+func WithPassword(password string) Option {
+	return func(s *Store) {
+		s.password = password
+	}
+}
+
+// WithDB sets the database selected with SELECT on every new connection, 0 by default.
+func WithDB(db int) Option {
+	return func(s *Store) {
+		s.db = db
+	}
+}
+
+// WithPoolSize sets the number of idle connections kept for reuse, 4 by default. A size <= 0 is
+// ignored.
+func WithPoolSize(size int) Option {
+	return func(s *Store) {
+		if size > 0 {
+			s.poolSize = size
+		}
+	}
+}
+
+// NewStore returns a new Store for the server at the address, for example "localhost:6379".
+//
+// The connections are made when needed, so NewStore does not fail if the server is unavailable,
+// the operations of the Store return the error instead.
+func NewStore(addr string, opts ...Option) *Store {
+	s := &Store{
+		addr:     addr,
+		password: "",
+		db:       0,
+		dialer:   &net.Dialer{},
+		mu:       &sync.Mutex{},
+		idle:     []*conn{},
+		poolSize: 4,
+		closed:   false,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Increment adds n to the counter of the key and returns the new value. A key that doesn't exist
+// is created with the ttl before it is incremented, in a transaction (MULTI, EXEC) so the key
+// can't expire in between.
+func (s *Store) Increment(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := s.with(ctx, func(c *conn) error {
+		replies, err := c.do(ctx,
+			[]string{"MULTI"},
+			[]string{"SET", key, "0", "NX", "PX", milliseconds(ttl)},
+			[]string{"INCRBY", key, strconv.FormatInt(n, 10)},
+			[]string{"EXEC"},
+		)
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if err := replyError(reply); err != nil {
+				return err
+			}
+		}
+		results, ok := replies[3].([]any)
+		if !ok || len(results) != 2 {
+			return fmt.Errorf("rateredis: unexpected reply %v", replies[3])
+		}
+		value, err = replyInt(results[1])
+		return err
+	})
+	return value, err
+}
+
+// CompareAndSwap sets the counter of the key to new, expiring after ttl, if its value is old. It
+// uses an optimistic transaction (WATCH, MULTI, EXEC) so it fails if the key changes in between.
+func (s *Store) CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	var swapped bool
+	err := s.with(ctx, func(c *conn) error {
+		replies, err := c.do(ctx, []string{"WATCH", key}, []string{"GET", key})
+		if err != nil {
+			return err
+		}
+		if err := replyError(replies[0]); err != nil {
+			return err
+		}
+		current, err := replyInt(replies[1])
+		if err != nil {
+			return err
+		}
+		if current != old {
+			replies, err := c.do(ctx, []string{"UNWATCH"})
+			if err != nil {
+				return err
+			}
+			return replyError(replies[0])
+		}
+		replies, err = c.do(ctx,
+			[]string{"MULTI"},
+			[]string{"SET", key, strconv.FormatInt(new, 10), "PX", milliseconds(ttl)},
+			[]string{"EXEC"},
+		)
+		if err != nil {
+			return err
+		}
+		for _, reply := range replies {
+			if err := replyError(reply); err != nil {
+				return err
+			}
+		}
+		// EXEC replies nil when a watched key changed and the transaction was aborted
+		swapped = replies[2] != nil
+		return nil
+	})
+	return swapped, err
+}
+
+// Close closes the idle connections, the Store can't be used afterwards.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	var errs []error
+	for _, c := range s.idle {
+		errs = append(errs, c.netConn.Close())
+	}
+	s.idle = nil
+	return errors.Join(errs...)
+}
+
+// runs f with a connection from the pool. The connection is returned to the pool unless f fails,
+// since the state of a connection is unknown after an error.
+func (s *Store) with(ctx context.Context, f func(c *conn) error) error {
+	c, err := s.get(ctx)
+	if err != nil {
+		return err
+	}
+	if err := f(c); err != nil {
+		c.netConn.Close()
+		return err
+	}
+	s.put(c)
+	return nil
+}
+
+// returns an idle connection or a new one
+func (s *Store) get(ctx context.Context) (*conn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, errors.New("rateredis: store closed")
+	}
+	if len(s.idle) > 0 {
+		c := s.idle[len(s.idle)-1]
+		s.idle = s.idle[:len(s.idle)-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+	return s.dial(ctx)
+}
+
+// returns the connection to the pool, or closes it if the pool is full
+func (s *Store) put(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || len(s.idle) >= s.poolSize {
+		c.netConn.Close()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// makes a new connection, authenticating and selecting the database if configured
+func (s *Store) dial(ctx context.Context) (*conn, error) {
+	netConn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	c := newConn(netConn)
+	var commands [][]string
+	if s.password != "" {
+		commands = append(commands, []string{"AUTH", s.password})
+	}
+	if s.db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(s.db)})
+	}
+	if len(commands) == 0 {
+		return c, nil
+	}
+	replies, err := c.do(ctx, commands...)
+	if err == nil {
+		for _, reply := range replies {
+			if err = replyError(reply); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,169 @@
+package rateredis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate"
+)
+
+func TestStoreIncrement(t *testing.T) {
+	server := newTestServer(t, "")
+	store := NewStore(server.addr())
+	defer store.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		key   string
+		n     int64
+		sleep time.Duration
+		want  int64
+	}{
+		{name: "New key", key: "a", n: 2, want: 2},
+		{name: "Existing key", key: "a", n: 3, want: 5},
+		{name: "Read", key: "a", n: 0, want: 5},
+		{name: "Other key", key: "b", n: 1, want: 1},
+		{name: "Expired key", key: "a", n: 1, sleep: time.Millisecond * 250, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			time.Sleep(tt.sleep)
+			got, err := store.Increment(ctx, tt.key, tt.n, time.Millisecond*200)
+			if err != nil || got != tt.want {
+				t.Errorf("Store.Increment(%q, %v), want %v, got %v %v", tt.key, tt.n, tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestStoreCompareAndSwap(t *testing.T) {
+	server := newTestServer(t, "")
+	store := NewStore(server.addr())
+	defer store.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		old  int64
+		new  int64
+		want bool
+	}{
+		{name: "Missing key is 0", old: 0, new: 3, want: true},
+		{name: "Old value matches", old: 3, new: 4, want: true},
+		{name: "Old value doesn't match", old: 3, new: 5, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.CompareAndSwap(ctx, "key", tt.old, tt.new, time.Second)
+			if err != nil || got != tt.want {
+				t.Errorf("Store.CompareAndSwap(%v, %v), want %v, got %v %v", tt.old, tt.new, tt.want, got, err)
+			}
+		})
+	}
+	if got, _ := store.Increment(ctx, "key", 0, time.Second); got != 4 {
+		t.Errorf("Store.Increment(0) after CompareAndSwap, want 4, got %v", got)
+	}
+	if got := server.count("UNWATCH"); got != 1 {
+		t.Errorf("UNWATCH commands after a failed compare, want 1, got %v", got)
+	}
+}
+
+func TestStoreAuth(t *testing.T) {
+	server := newTestServer(t, "secret")
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantErr  bool
+		wantAuth int
+	}{
+		{name: "No password", opts: nil, wantErr: true},
+		{name: "Wrong password", opts: []Option{WithPassword("wrong")}, wantErr: true},
+		{name: "Password and database", opts: []Option{WithPassword("secret"), WithDB(2)}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewStore(server.addr(), tt.opts...)
+			defer store.Close()
+			_, err := store.Increment(ctx, "key", 1, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Store.Increment(), wantErr %v, got %v", tt.wantErr, err)
+			}
+			var serverErr *ServerError
+			if tt.wantErr && !errors.As(err, &serverErr) {
+				t.Errorf("Store.Increment(), want ServerError, got %v", err)
+			}
+		})
+	}
+	if got := server.count("SELECT"); got != 1 {
+		t.Errorf("SELECT commands, want 1, got %v", got)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	listener := newTestServer(t, "")
+	addr := listener.addr()
+	listener.listener.Close()
+
+	store := NewStore(addr)
+	if _, err := store.Increment(context.Background(), "key", 1, time.Second); err == nil {
+		t.Errorf("Store.Increment() with the server down, want error, got nil")
+	}
+
+	// a server that accepts connections but never replies
+	silent := newTestServer(t, "")
+	silent.mu.Lock()
+	defer silent.mu.Unlock()
+	store = NewStore(silent.addr())
+	defer store.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	if _, err := store.Increment(ctx, "key", 1, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Store.Increment() with no reply, want context.DeadlineExceeded, got %v", err)
+	}
+
+	store.Close()
+	if _, err := store.Increment(context.Background(), "key", 1, time.Second); err == nil {
+		t.Errorf("Store.Increment() after Close, want error, got nil")
+	}
+}
+
+func TestDistributedLimiter(t *testing.T) {
+	server := newTestServer(t, "")
+	var granted atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		// every replica has its own store, as separate processes would
+		store := NewStore(server.addr())
+		defer store.Close()
+		limiter := rate.NewDistributedLimiter(store, "api", 10, time.Minute)
+		for j := 0; j < 5; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := limiter.TryWait()
+				if err == nil {
+					granted.Add(1)
+					return
+				}
+				var overLimit *rate.LimiterOverLimitError
+				if !errors.As(err, &overLimit) {
+					t.Errorf("DistributedLimiter.TryWait(), want nil or LimiterOverLimitError, got %v", err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if got := granted.Load(); got != 10 {
+		t.Errorf("DistributedLimiter.TryWait() granted across replicas, want 10, got %v", got)
+	}
+}
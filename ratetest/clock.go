@@ -0,0 +1,112 @@
+package ratetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A ManualClock is a clock that only moves when told to, it implements the rate.Clock interface.
+type ManualClock struct {
+	mu     *sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*manualTimer
+}
+
+// a timer waiting for the ManualClock to reach its deadline
+type manualTimer struct {
+	deadline time.Time
+	c        chan time.Time
+}
+
+// NewManualClock returns a new ManualClock set to the given time.
+func NewManualClock(now time.Time) *ManualClock {
+	c := &ManualClock{
+		mu:     &sync.Mutex{},
+		now:    now,
+		timers: []*manualTimer{},
+	}
+	c.cond = sync.NewCond(c.mu)
+	return c
+}
+
+// Now returns the current time of the ManualClock.
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a channel that receives the time once the ManualClock is advanced by d and a
+// function to stop the timer. A timer with d <= 0 fires immediately.
+func (c *ManualClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{
+		deadline: c.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c, func() bool { return false }
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t.c, func() bool {
+		return c.stop(t)
+	}
+}
+
+// Advance moves the ManualClock forward by d firing the timers whose deadline passed, in the order
+// of their deadlines.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+	fired := 0
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			break
+		}
+		t.c <- c.now
+		fired++
+	}
+	c.timers = c.timers[fired:]
+	c.cond.Broadcast()
+}
+
+// Timers returns the number of timers waiting for the ManualClock to reach their deadline.
+func (c *ManualClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// BlockUntil blocks until at least n timers are waiting for the ManualClock to reach their
+// deadline. It is used to wait for the goroutines under test to block on the clock before
+// advancing it.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// removes the timer, returns false if it already fired or was stopped
+func (c *ManualClock) stop(t *manualTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package ratetest
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	later, _ := clock.NewTimer(time.Second * 2)
+	sooner, _ := clock.NewTimer(time.Second)
+	stopped, stop := clock.NewTimer(time.Second)
+	immediate, _ := clock.NewTimer(0)
+
+	select {
+	case <-immediate:
+	default:
+		t.Errorf("ManualClock.NewTimer(0), want fired, got pending")
+	}
+	if !stop() {
+		t.Errorf("ManualClock.NewTimer() stop, want true, got false")
+	}
+	if got := clock.Timers(); got != 2 {
+		t.Errorf("ManualClock.Timers(), want 2, got %v", got)
+	}
+
+	clock.Advance(time.Second)
+	if got := clock.Now(); !got.Equal(start.Add(time.Second)) {
+		t.Errorf("ManualClock.Now(), want %v, got %v", start.Add(time.Second), got)
+	}
+	select {
+	case <-sooner:
+	default:
+		t.Errorf("ManualClock.Advance(1s), want sooner timer fired, got pending")
+	}
+	select {
+	case <-later:
+		t.Errorf("ManualClock.Advance(1s), want later timer pending, got fired")
+	case <-stopped:
+		t.Errorf("ManualClock.Advance(1s), want stopped timer pending, got fired")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-later:
+	default:
+		t.Errorf("ManualClock.Advance(2s), want later timer fired, got pending")
+	}
+	if got := clock.Timers(); got != 0 {
+		t.Errorf("ManualClock.Timers(), want 0, got %v", got)
+	}
+}
+
+func TestManualClockBlockUntil(t *testing.T) {
+	clock := NewManualClock(time.Now())
+	done := make(chan struct{})
+	go func() {
+		c, _ := clock.NewTimer(time.Minute)
+		<-c
+		close(done)
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	<-done
+}
@@ -0,0 +1,5 @@
+// Package ratetest provides utilities for testing code that uses the rate package.
+//
+// The ManualClock can be passed to the limiter constructors with rate.WithClock so tests control
+// the passing of time instead of sleeping, making them fast and deterministic.
+package ratetest
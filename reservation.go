@@ -0,0 +1,214 @@
+package rate
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Reservation holds permits reserved from an UnbufferedLimiter for a time that may be in the
+// future.
+type Reservation struct {
+	mu        *sync.Mutex
+	limiter   *UnbufferedLimiter
+	ok        bool
+	n         int
+	timeToAct time.Time
+	canceled  bool
+}
+
+// Reserve reserves a permit from the UnbufferedLimiter, the Reservation tells how long to wait
+// before acting.
+//
+// Unlike TryWait, Reserve records the permit even when the rate was reached, at the time
+// it can be granted, which is the time TryWait returns as remaining. The permit counts against
+// the rate from then on, so the caller must wait for Delay before acting or Cancel the Reservation.
+// The Reservation is not OK if the limiter is closed.
+func (l *UnbufferedLimiter) Reserve() *Reservation {
+	return l.ReserveN(1)
+}
+
+// ReserveN is like Reserve but reserves n permits at once. The Reservation is not OK if n is greater
+// than the rate since the permits could never be granted, and if n <= 0 it is OK without a delay.
+func (l *UnbufferedLimiter) ReserveN(n int) *Reservation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	r := &Reservation{
+		mu:        &sync.Mutex{},
+		limiter:   l,
+		ok:        false,
+		n:         n,
+		timeToAct: now,
+		canceled:  false,
+	}
+	if l.closed || n > len(l.timeStamps) {
+		return r
+	}
+	r.ok = true
+	if n <= 0 {
+		return r
+	}
+	// the permits are reserved for the time TryWaitN would report them as available
+	l.settle(now)
+	r.timeToAct = l.earliest(now, n)
+	if !r.timeToAct.After(now) {
+		// recorded at exactly the reserved time so Cancel finds the time stamps
+		l.recordN(r.timeToAct, n)
+		return r
+	}
+	i := sort.Search(len(l.pending), func(i int) bool { return l.pending[i].After(r.timeToAct) })
+	reserved := make([]time.Time, n)
+	for j := range reserved {
+		reserved[j] = r.timeToAct
+	}
+	l.pending = slices.Insert(l.pending, i, reserved...)
+	return r
+}
+
+// OK returns whether the permits were reserved. A Reservation that is not OK holds no permits.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before acting on the Reservation, 0 if it can be acted on now.
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return 0
+	}
+	return max(r.timeToAct.Sub(r.limiter.clock.Now()), 0)
+}
+
+// Cancel gives the reserved permits back to the UnbufferedLimiter, for example when the operation
+// turned out not to be needed.
+//
+// The permits are restored if the reserved time hasn't passed, and after it as long as they still
+// count against the rate, that is until an interval after the reserved time, so permits reserved
+// for now can be given back once the operation turns out not to be needed. The reservations made
+// after it keep their time. Calling Cancel more than once or on a Reservation that is not OK has no
+// effect.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.ok || r.canceled || r.n <= 0 {
+		return
+	}
+	r.canceled = true
+	r.limiter.restore(r.timeToAct, r.n)
+}
+
+// removes n permits granted or reserved at the given time, as if they were never granted
+func (l *UnbufferedLimiter) restore(at time.Time, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	l.settle(now)
+	if at.After(now) {
+		// the reservation is still pending, its permits are in the pending reservations
+		i := sort.Search(len(l.pending), func(i int) bool { return !l.pending[i].Before(at) })
+		l.pending = slices.Delete(l.pending, i, i+n)
+		return
+	}
+	if !now.Before(at.Add(l.interval)) { // the permits no longer count against the rate
+		return
+	}
+	rate := len(l.timeStamps)
+	for ; n > 0; n-- {
+		// the time stamps are in the order they were recorded, search from the most recent. A time
+		// stamp that is no longer in the ring was followed by rate more recent grants, removing it
+		// would not change what is granted
+		slot := -1
+		for i := 1; i <= rate; i++ {
+			pos := (l.index - i + rate) % rate
+			if l.timeStamps[pos].Equal(at) {
+				slot = pos
+				break
+			}
+			if l.timeStamps[pos].Before(at) {
+				break
+			}
+		}
+		if slot == -1 {
+			return
+		}
+		// shift the older time stamps forward and free the oldest slot so the order is kept. The
+		// grant that slot held before was at least an interval older than the one that replaced
+		// it, so it no longer counts against the rate
+		for pos := slot; pos != l.index; {
+			prev := (pos - 1 + rate) % rate
+			l.timeStamps[pos] = l.timeStamps[prev]
+			pos = prev
+		}
+		l.timeStamps[l.index] = time.Time{}
+	}
+}
+
+// records the pending reservations whose time has come as granted, so the time stamps only hold
+// grants that are not in the future. Must be called while holding the lock.
+func (l *UnbufferedLimiter) settle(now time.Time) {
+	settled := 0
+	for settled < len(l.pending) && !l.pending[settled].After(now) {
+		l.recordN(l.pending[settled], 1)
+		settled++
+	}
+	l.pending = slices.Delete(l.pending, 0, settled)
+}
+
+// returns the earliest time, now or later, that n permits can be granted without more than rate
+// permits in any interval, counting the pending reservations. n must be between 1 and the rate.
+// Must be called while holding the lock after settle.
+func (l *UnbufferedLimiter) earliest(now time.Time, n int) time.Time {
+	// the time stamps are in the order they were recorded so the n-th slot from the index is the
+	// most recent of the n slots, it must be older than the interval
+	t := l.timeStamps[(l.index+n-1)%len(l.timeStamps)].Add(l.interval)
+	if t.Before(now) {
+		t = now
+	}
+	// a time that does not fit can only fit later once one more grant in the interval before it is
+	// older than the interval, there is always one since the grants in that interval did not fit
+	for !l.fits(t, n) {
+		var next time.Time
+		if i := l.timeStampsFrom(t.Add(-l.interval + 1)); i < len(l.timeStamps) {
+			next = l.timeStamps[(l.index+i)%len(l.timeStamps)].Add(l.interval)
+		}
+		i := sort.Search(len(l.pending), func(i int) bool { return l.pending[i].After(t.Add(-l.interval)) })
+		if i < len(l.pending) && (next.IsZero() || l.pending[i].Add(l.interval).Before(next)) {
+			next = l.pending[i].Add(l.interval)
+		}
+		t = next
+	}
+	return t
+}
+
+// returns whether n more permits granted at t keep every interval containing t within the rate.
+// Must be called while holding the lock after settle.
+func (l *UnbufferedLimiter) fits(t time.Time, n int) bool {
+	// the intervals containing t start in (t-interval, t]. The number of grants in an interval only
+	// increases where a pending reservation enters it so only those starts need to be counted, the
+	// time stamps are all before t and in every one of those intervals from the start
+	starts := []time.Time{t.Add(-l.interval + 1)}
+	for _, p := range l.pending {
+		if start := p.Add(-l.interval + 1); start.After(starts[0]) && !start.After(t) {
+			starts = append(starts, start)
+		}
+	}
+	for _, start := range starts {
+		end := start.Add(l.interval)
+		first := sort.Search(len(l.pending), func(i int) bool { return !l.pending[i].Before(start) })
+		last := sort.Search(len(l.pending), func(i int) bool { return !l.pending[i].Before(end) })
+		granted := len(l.timeStamps) - l.timeStampsFrom(start) + last - first
+		if granted+n > len(l.timeStamps) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the position from the index of the oldest time stamp at or after start, the rate if
+// there is none. Must be called while holding the lock.
+func (l *UnbufferedLimiter) timeStampsFrom(start time.Time) int {
+	return sort.Search(len(l.timeStamps), func(i int) bool {
+		return !l.timeStamps[(l.index+i)%len(l.timeStamps)].Before(start)
+	})
+}
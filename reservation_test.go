@@ -0,0 +1,275 @@
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestReserve(t *testing.T) {
+	tests := []struct {
+		name      string
+		rate      int
+		taken     int
+		n         int
+		wantOK    bool
+		wantDelay time.Duration
+		wantErr   bool
+	}{
+		{
+			name:      "Reserve an available permit",
+			rate:      2,
+			taken:     0,
+			n:         1,
+			wantOK:    true,
+			wantDelay: 0,
+			wantErr:   false,
+		},
+		{
+			name:      "Reserve a permit past the rate",
+			rate:      1,
+			taken:     1,
+			n:         1,
+			wantOK:    true,
+			wantDelay: time.Second,
+			wantErr:   true,
+		},
+		{
+			name:      "Reserve more permits than the rate",
+			rate:      2,
+			taken:     0,
+			n:         3,
+			wantOK:    false,
+			wantDelay: 0,
+			wantErr:   false,
+		},
+		{
+			name:      "Reserve no permits",
+			rate:      1,
+			taken:     0,
+			n:         0,
+			wantOK:    true,
+			wantDelay: 0,
+			wantErr:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewUnbufferedLimiter(tt.rate, time.Second, WithClock(clock))
+			for i := 0; i < tt.taken; i++ {
+				if _, err := limiter.TryWait(); err != nil {
+					t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+				}
+			}
+			r := limiter.ReserveN(tt.n)
+			if r.OK() != tt.wantOK {
+				t.Errorf("Reservation.OK(), want %v, got %v", tt.wantOK, r.OK())
+			}
+			if r.Delay() != tt.wantDelay {
+				t.Errorf("Reservation.Delay(), want %v, got %v", tt.wantDelay, r.Delay())
+			}
+			clock.Advance(tt.wantDelay)
+			if r.Delay() != 0 {
+				t.Errorf("Reservation.Delay() after the delay, want 0, got %v", r.Delay())
+			}
+			// the reserved permits count against the rate from the reserved time
+			if _, err := limiter.TryWait(); (err != nil) != tt.wantErr {
+				t.Errorf("UnbufferedLimiter.TryWait() after the delay, wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	limiter := NewUnbufferedLimiter(1, time.Second)
+	limiter.Close()
+	if r := limiter.Reserve(); r.OK() {
+		t.Errorf("UnbufferedLimiter.Reserve() after Close, want not OK, got OK")
+	}
+}
+
+func TestReservationCancel(t *testing.T) {
+	tests := []struct {
+		name          string
+		taken         int
+		advance       time.Duration
+		wantRemaining time.Duration
+	}{
+		{
+			name:          "Cancel an immediate reservation",
+			taken:         0,
+			advance:       0,
+			wantRemaining: 0,
+		},
+		{
+			name:          "Cancel an immediate reservation after it was acted on",
+			taken:         0,
+			advance:       500 * time.Millisecond,
+			wantRemaining: 0,
+		},
+		{
+			name:          "Cancel a future reservation",
+			taken:         1,
+			advance:       0,
+			wantRemaining: time.Second,
+		},
+		{
+			name:          "Cancel after the permit stopped counting",
+			taken:         0,
+			advance:       time.Second,
+			wantRemaining: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewUnbufferedLimiter(1, time.Second, WithClock(clock))
+			for i := 0; i < tt.taken; i++ {
+				if _, err := limiter.TryWait(); err != nil {
+					t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+				}
+			}
+			r := limiter.Reserve()
+			clock.Advance(tt.advance)
+			r.Cancel()
+			r.Cancel()
+			if remaining, _ := limiter.TryWait(); remaining != tt.wantRemaining {
+				t.Errorf("UnbufferedLimiter.TryWait() after Cancel, want %v, got %v", tt.wantRemaining, remaining)
+			}
+		})
+	}
+}
+
+func TestReservationCancelSystemClock(t *testing.T) {
+	// the system clock moves between calls so the permit must be recorded at the reserved time
+	limiter := NewUnbufferedLimiter(1, time.Hour)
+	r := limiter.Reserve()
+	if !r.OK() || r.Delay() != 0 {
+		t.Fatalf("UnbufferedLimiter.Reserve(), want OK without a delay, got OK %v with %v", r.OK(), r.Delay())
+	}
+	time.Sleep(time.Millisecond)
+	r.Cancel()
+	if _, err := limiter.TryWait(); err != nil {
+		t.Errorf("UnbufferedLimiter.TryWait() after Cancel, want nil, got %v", err)
+	}
+}
+
+func TestReservationCancelKeepsOrder(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewUnbufferedLimiter(3, time.Second, WithClock(clock))
+	if _, err := limiter.TryWait(); err != nil {
+		t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+	}
+	clock.Advance(100 * time.Millisecond)
+	r := limiter.Reserve()
+	clock.Advance(100 * time.Millisecond)
+	if _, err := limiter.TryWait(); err != nil {
+		t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+	}
+	r.Cancel()
+	// one permit is free again, the next one is the oldest grant
+	if _, err := limiter.TryWait(); err != nil {
+		t.Errorf("UnbufferedLimiter.TryWait() after Cancel, want nil, got %v", err)
+	}
+	if remaining, _ := limiter.TryWait(); remaining != 800*time.Millisecond {
+		t.Errorf("UnbufferedLimiter.TryWait() at the rate, want 800ms remaining, got %v", remaining)
+	}
+}
+
+func TestReservationCancelOutOfOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		canceled  []int
+		wantDelay time.Duration
+	}{
+		{
+			name:      "Cancel a reservation between two others",
+			canceled:  []int{1},
+			wantDelay: time.Second,
+		},
+		{
+			name:      "Cancel every reservation after the first",
+			canceled:  []int{1, 2, 3},
+			wantDelay: time.Second,
+		},
+		{
+			name:      "Cancel in reverse order",
+			canceled:  []int{3, 2, 1},
+			wantDelay: time.Second,
+		},
+		{
+			name:      "Cancel the most recent reservations only",
+			canceled:  []int{2, 3},
+			wantDelay: time.Second * 2,
+		},
+		{
+			name:      "Cancel the first reservation",
+			canceled:  []int{0},
+			wantDelay: 0,
+		},
+		{
+			name:      "Cancel none",
+			canceled:  []int{},
+			wantDelay: time.Second * 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewUnbufferedLimiter(1, time.Second, WithClock(clock))
+			reservations := make([]*Reservation, 4)
+			for i := range reservations {
+				reservations[i] = limiter.Reserve()
+				if want := time.Duration(i) * time.Second; reservations[i].Delay() != want {
+					t.Fatalf("UnbufferedLimiter.Reserve() %v/4, want Delay %v, got %v", i+1, want, reservations[i].Delay())
+				}
+			}
+			for _, i := range tt.canceled {
+				reservations[i].Cancel()
+			}
+			// a new reservation takes the earliest time that was freed
+			if got := limiter.Reserve().Delay(); got != tt.wantDelay {
+				t.Errorf("UnbufferedLimiter.Reserve() after Cancel, want Delay %v, got %v", tt.wantDelay, got)
+			}
+		})
+	}
+}
+
+func TestReservationCancelFullRing(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	limiter := NewUnbufferedLimiter(2, time.Second, WithClock(clock))
+	if _, err := limiter.TryWaitN(2); err != nil {
+		t.Fatalf("UnbufferedLimiter.TryWaitN(2), want nil, got %v", err)
+	}
+	first := limiter.Reserve()
+	second := limiter.Reserve()
+	third := limiter.Reserve()
+	if first.Delay() != time.Second || second.Delay() != time.Second || third.Delay() != time.Second*2 {
+		t.Fatalf("UnbufferedLimiter.Reserve() with a full ring, want Delays 1s, 1s and 2s, got %v, %v and %v", first.Delay(), second.Delay(), third.Delay())
+	}
+
+	first.Cancel()
+	third.Cancel()
+	if remaining, err := limiter.TryWait(); err == nil || remaining != time.Second {
+		t.Errorf("UnbufferedLimiter.TryWait() after Cancel, want 1s remaining, got %v, %v", remaining, err)
+	}
+	if got := limiter.Reserve().Delay(); got != time.Second {
+		t.Errorf("UnbufferedLimiter.Reserve() after Cancel, want Delay 1s, got %v", got)
+	}
+
+	// the canceled reservations stay canceled once the reserved time passed
+	clock.Advance(time.Second)
+	if remaining, err := limiter.TryWait(); err == nil || remaining != time.Second {
+		t.Errorf("UnbufferedLimiter.TryWait() at the reserved time, want 1s remaining, got %v, %v", remaining, err)
+	}
+	if s := limiter.Stats(); s.Available != 0 || !s.NextAvailable.Equal(clock.Now().Add(time.Second)) {
+		t.Errorf("UnbufferedLimiter.Stats() at the reserved time, want 0 available until 1s later, got %v until %v", s.Available, s.NextAvailable.Sub(clock.Now()))
+	}
+	clock.Advance(time.Second)
+	if _, err := limiter.TryWaitN(2); err != nil {
+		t.Errorf("UnbufferedLimiter.TryWaitN(2) an interval after the reservations, want nil, got %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package rate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// A SlidingWindowLimiter is a limiter without an internal buffer that approximates the permissions
+// granted in the last interval from the counts of two fixed time windows
+type SlidingWindowLimiter struct {
+	mu          *sync.Mutex
+	rate        int
+	interval    time.Duration
+	windowStart time.Time
+	previous    int
+	current     int
+	clock       Clock
+	closed      bool
+}
+
+// NewSlidingWindowLimiter returns a new SlidingWindowLimiter given a rate and a time interval.
+//
+// The SlidingWindowLimiter counts the permissions granted in fixed windows the length of the
+// interval like the FixedWindowLimiter, but estimates the permissions granted in the last interval
+// by weighting the count of the previous window by how much of it still overlaps the last
+// interval. It only keeps two counts, so its memory usage does not depend on the rate.
+//
+// The estimate assumes the permissions in the previous window were granted evenly, so the rate is
+// enforced closely but not exactly, it is usually within a few percent for steady traffic. Unlike
+// the FixedWindowLimiter it does not allow twice the rate at the boundary between windows. Use the
+// UnbufferedLimiter when the rate must be enforced exactly.
+//
+// If the rate received <= 0 the rate will default to 1 and if the interval received <= 0 it will
+// be set to 1 millisecond. This is to prevent the SlidingWindowLimiter from erroring during use
+// without the NewSlidingWindowLimiter function returning an error.
+//
+// The options configure the rest of the SlidingWindowLimiter, such as the clock it uses.
+func NewSlidingWindowLimiter(rate int, interval time.Duration, opts ...Option) *SlidingWindowLimiter {
+	o := newOptions(opts)
+	if rate <= 0 {
+		rate = 1
+	}
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return &SlidingWindowLimiter{
+		mu:          &sync.Mutex{},
+		rate:        rate,
+		interval:    interval,
+		windowStart: time.Time{},
+		previous:    0,
+		current:     0,
+		clock:       o.clock,
+		closed:      false,
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// The Wait receiver on the SlidingWindowLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// SlidingWindowLimiter will grant permission.
+func (l *SlidingWindowLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned.
+func (l *SlidingWindowLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// If n is greater than the rate a LimiterRequestTooLarge error is returned, and if n <= 0 WaitN
+// returns nil immediately.
+func (l *SlidingWindowLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, l.TryWaitN)
+}
+
+// TryWait returns whether or not the SlidingWindowLimiter granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
+// is nil. If permission is not granted a LimiterOverLimit error is returned and the estimated time
+// duration until permission can be granted. Once the limiter is closed a LimiterClosed error is
+// returned.
+func (l *SlidingWindowLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned, and if n <= 0 nothing is granted and the error is nil.
+func (l *SlidingWindowLimiter) TryWaitN(n int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	remaining, err := l.checkN(n)
+	if err != nil || n <= 0 {
+		return remaining, err
+	}
+	l.commitN(n)
+	return 0, nil
+}
+
+func (l *SlidingWindowLimiter) lock()   { l.mu.Lock() }
+func (l *SlidingWindowLimiter) unlock() { l.mu.Unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *SlidingWindowLimiter) checkN(n int) (time.Duration, error) {
+	if l.closed {
+		return 0, newClosedError()
+	}
+	if n > l.rate {
+		return 0, newRequestTooLargeError(l.rate)
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	now := l.clock.Now()
+	l.advance(now)
+	elapsed := now.Sub(l.windowStart)
+	if l.estimate(elapsed)+float64(n) <= float64(l.rate) {
+		return 0, nil
+	}
+	remaining := l.remaining(elapsed, n)
+	return remaining, newOverLimitError(remaining, l.rate)
+}
+
+// counts n permits in the current window. Must be called while holding the lock after checkN
+// allowed them.
+func (l *SlidingWindowLimiter) commitN(n int) {
+	l.current += n
+}
+
+// Close closes the SlidingWindowLimiter.
+//
+// The SlidingWindowLimiter holds no resources so Close only marks the limiter as closed, all
+// subsequent calls to Wait and TryWait return a LimiterClosed error. Calling Close more than once
+// has no effect and the returned error is always nil.
+func (l *SlidingWindowLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+// moves the windows forward so the current window contains now. Must be called while holding the
+// lock.
+func (l *SlidingWindowLimiter) advance(now time.Time) {
+	switch windows := now.Sub(l.windowStart) / l.interval; {
+	case windows >= 2: // both windows are over
+		l.windowStart = now.Truncate(l.interval)
+		l.previous = 0
+		l.current = 0
+	case windows == 1:
+		l.windowStart = l.windowStart.Add(l.interval)
+		l.previous = l.current
+		l.current = 0
+	}
+}
+
+// returns the estimated number of permissions granted in the last interval given the time elapsed
+// since the start of the current window
+func (l *SlidingWindowLimiter) estimate(elapsed time.Duration) float64 {
+	return slidingEstimate(l.previous, l.current, l.interval, elapsed)
+}
+
+// returns the estimated time until n permits can be granted given the time elapsed since the start
+// of the current window
+func (l *SlidingWindowLimiter) remaining(elapsed time.Duration, n int) time.Duration {
+	return slidingRemaining(l.rate, l.previous, l.current, n, l.interval, elapsed)
+}
+
+// returns the estimated number of permissions granted in the last interval given the counts of the
+// previous and current windows and the time elapsed since the start of the current window
+func slidingEstimate(previous, current int, interval, elapsed time.Duration) float64 {
+	overlap := float64(interval-elapsed) / float64(interval)
+	return float64(previous)*overlap + float64(current)
+}
+
+// returns the estimated time until n permits can be granted at the rate given the counts of the
+// previous and current windows and the time elapsed since the start of the current window
+func slidingRemaining(rate, previous, current, n int, interval, elapsed time.Duration) time.Duration {
+	length := float64(interval)
+	// wait for the weight of the previous window to drop enough within the current window
+	if allowed := float64(rate - current - n); allowed >= 0 && previous > 0 {
+		wait := length - float64(elapsed) - allowed*length/float64(previous)
+		if wait < float64(interval-elapsed) {
+			return time.Duration(math.Ceil(math.Max(wait, 0)))
+		}
+	}
+	// otherwise wait for the next window, where the current window becomes the previous one
+	wait := float64(interval - elapsed)
+	if current > 0 {
+		wait += math.Max(length-float64(rate-n)*length/float64(current), 0)
+	}
+	return time.Duration(math.Ceil(wait))
+}
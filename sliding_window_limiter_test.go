@@ -0,0 +1,93 @@
+package rate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowWait(t *testing.T) {
+	tests := []struct {
+		name        string
+		limiter     *SlidingWindowLimiter
+		count       int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "Within limit",
+			limiter:     NewSlidingWindowLimiter(5, time.Second),
+			count:       5,
+			minDuration: 0,
+			maxDuration: time.Second,
+		},
+		{
+			name:        "7 requests at 3 per second",
+			limiter:     NewSlidingWindowLimiter(3, time.Second),
+			count:       7,
+			minDuration: time.Second,
+			maxDuration: time.Second * 3,
+		},
+		{
+			name:        "High rate",
+			limiter:     NewSlidingWindowLimiter(1_000_000, time.Minute),
+			count:       10_000,
+			minDuration: 0,
+			maxDuration: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			for i := 0; i < tt.count; i++ {
+				if gotErr := tt.limiter.Wait(nil); gotErr != nil {
+					t.Errorf("SlidingWindowLimiter.Wait() %v/%v, want nil, got %v", i+1, tt.count, gotErr)
+				}
+			}
+			gotDuration := time.Since(start)
+			if gotDuration < tt.minDuration || gotDuration > tt.maxDuration {
+				t.Errorf("SlidingWindowLimiter.Wait(), wantDuration in range (%v, %v) got %v", tt.minDuration, tt.maxDuration, gotDuration)
+			}
+		})
+	}
+}
+
+func TestSlidingWindowRemaining(t *testing.T) {
+	tests := []struct {
+		name          string
+		previous      int
+		current       int
+		elapsed       time.Duration
+		n             int
+		wantRemaining time.Duration
+	}{
+		{
+			name:          "Previous window weight drops within the current window",
+			previous:      4,
+			current:       0,
+			elapsed:       0,
+			n:             1,
+			wantRemaining: time.Second / 4,
+		},
+		{
+			name:          "Wait for the next window",
+			previous:      0,
+			current:       4,
+			elapsed:       time.Second / 2,
+			n:             1,
+			wantRemaining: time.Second/2 + time.Second/4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := NewSlidingWindowLimiter(4, time.Second)
+			limiter.previous = tt.previous
+			limiter.current = tt.current
+			gotRemaining := limiter.remaining(tt.elapsed, tt.n)
+			if gotRemaining != tt.wantRemaining {
+				t.Errorf("SlidingWindowLimiter.remaining(), wantRemaining %v, got %v", tt.wantRemaining, gotRemaining)
+			}
+		})
+	}
+}
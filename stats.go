@@ -0,0 +1,71 @@
+package rate
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the state of a limiter and of the outcomes of the requests it received.
+//
+// The counters are cumulative since the limiter was created. A request that waits counts once, for
+// the outcome it returned, and a request for n permits counts as one request.
+type Stats struct {
+	Rate          int           // the permissions granted per interval
+	Interval      time.Duration // the time interval of the rate
+	Available     int           // the permissions that can be granted now
+	NextAvailable time.Time     // the time the next permission can be granted, now if Available > 0
+	Queued        int           // the requests waiting in the buffer, 0 for unbuffered limiters
+	Capacity      int           // the capacity of the buffer, per flow with fair queueing, 0 if none
+	Granted       uint64        // the requests that were granted permission
+	TimedOut      uint64        // the requests that returned a LimiterWaitTimedOut error
+	BufferFull    uint64        // the requests that returned a LimiterBufferFull error
+	OverLimit     uint64        // the calls to TryWait that returned a LimiterOverLimit error
+}
+
+// counters counts the outcomes of the requests a limiter received, it is safe for concurrent use
+type counters struct {
+	granted    atomic.Uint64
+	timedOut   atomic.Uint64
+	bufferFull atomic.Uint64
+	overLimit  atomic.Uint64
+}
+
+// record counts the outcome of a request given the error it returned
+func (c *counters) record(err error) {
+	switch err.(type) {
+	case nil:
+		c.granted.Add(1)
+	case *LimiterWaitTimedOutError:
+		c.timedOut.Add(1)
+	case *LimiterBufferFullError:
+		c.bufferFull.Add(1)
+	case *LimiterOverLimitError:
+		c.overLimit.Add(1)
+	}
+}
+
+// fill sets the counters of the stats
+func (c *counters) fill(s *Stats) {
+	s.Granted = c.granted.Load()
+	s.TimedOut = c.timedOut.Load()
+	s.BufferFull = c.bufferFull.Load()
+	s.OverLimit = c.overLimit.Load()
+}
+
+// returns the number of permissions that can be granted now and the time the next one can be
+// granted, given the time stamps of a sliding log limiter starting at the oldest one at the index
+func availableTimeStamps(timeStamps []time.Time, index int, interval time.Duration, now time.Time) (int, time.Time) {
+	available := 0
+	for available < len(timeStamps) {
+		// the time stamps are in the order they were recorded so the first one still in the
+		// interval ends the count
+		if now.Sub(timeStamps[(index+available)%len(timeStamps)]) < interval {
+			break
+		}
+		available++
+	}
+	if available > 0 {
+		return available, now
+	}
+	return 0, timeStamps[index].Add(interval)
+}
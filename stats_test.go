@@ -0,0 +1,120 @@
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestUnbufferedStats(t *testing.T) {
+	start := time.Now()
+	clock := ratetest.NewManualClock(start)
+	limiter := NewUnbufferedLimiter(2, time.Second, WithClock(clock))
+
+	limiter.TryWait()
+	clock.Advance(time.Millisecond * 100)
+	limiter.TryWait()
+	limiter.TryWait()
+	ctx, cancel := context.WithDeadline(context.Background(), start)
+	defer cancel()
+	limiter.WaitContext(ctx)
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    Stats
+	}{
+		{
+			name:    "Over the limit",
+			advance: 0,
+			want: Stats{
+				Rate:          2,
+				Interval:      time.Second,
+				Available:     0,
+				NextAvailable: start.Add(time.Second),
+				Granted:       2,
+				TimedOut:      1,
+				OverLimit:     1,
+			},
+		},
+		{
+			name:    "Oldest permission expired",
+			advance: time.Millisecond * 900,
+			want: Stats{
+				Rate:          2,
+				Interval:      time.Second,
+				Available:     1,
+				NextAvailable: start.Add(time.Second),
+				Granted:       2,
+				TimedOut:      1,
+				OverLimit:     1,
+			},
+		},
+		{
+			name:    "All permissions expired",
+			advance: time.Millisecond * 100,
+			want: Stats{
+				Rate:          2,
+				Interval:      time.Second,
+				Available:     2,
+				NextAvailable: start.Add(time.Millisecond * 1100),
+				Granted:       2,
+				TimedOut:      1,
+				OverLimit:     1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			if got := limiter.Stats(); got != tt.want {
+				t.Errorf("UnbufferedLimiter.Stats(), want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBufferedStats(t *testing.T) {
+	start := time.Now()
+	clock := ratetest.NewManualClock(start)
+	limiter := NewBufferedLimiter(1, 1, time.Second, WithClock(clock))
+	defer limiter.Close()
+
+	limiter.TryWait()
+	limiter.TryWait()
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(nil)
+	}()
+	clock.BlockUntil(1) // the approval loop is waiting for the request to fit
+	limiter.Wait(nil)
+
+	want := Stats{
+		Rate:          1,
+		Interval:      time.Second,
+		Available:     0,
+		NextAvailable: start.Add(time.Second),
+		Queued:        1,
+		Capacity:      1,
+		Granted:       1,
+		BufferFull:    1,
+		OverLimit:     1,
+	}
+	if got := limiter.Stats(); got != want {
+		t.Errorf("BufferedLimiter.Stats() with a queued request, want %+v, got %+v", want, got)
+	}
+
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("BufferedLimiter.Wait(), want nil, got %v", err)
+	}
+	want.NextAvailable = start.Add(time.Second * 2)
+	want.Queued = 0
+	want.Granted = 2
+	if got := limiter.Stats(); got != want {
+		t.Errorf("BufferedLimiter.Stats() after the approval, want %+v, got %+v", want, got)
+	}
+}
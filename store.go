@@ -0,0 +1,105 @@
+package rate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store is a shared store of counters that expire, used by the DistributedLimiter to share the
+// permissions granted between processes. The operations must be atomic across all the processes
+// using the store.
+type Store interface {
+	// Increment adds n to the counter of the key and returns the new value. A key that doesn't
+	// exist or expired starts at 0 and expires after ttl, incrementing an existing key does not
+	// change when it expires. Incrementing by 0 reads the counter.
+	Increment(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error)
+
+	// CompareAndSwap sets the counter of the key to new, expiring after ttl, only if its value is
+	// old and returns whether it was set. A key that doesn't exist or expired has the value 0.
+	CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error)
+}
+
+// A MemoryStore is a Store that keeps the counters in memory. It can only share permissions
+// between the limiters of one process, which makes it useful for tests and as a stand in when
+// running a single process.
+type MemoryStore struct {
+	mu        *sync.Mutex
+	counters  map[string]memoryCounter
+	lastSweep int
+	clock     Clock
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// a counter of the MemoryStore and when it expires
+type memoryCounter struct {
+	value   int64
+	expires time.Time
+}
+
+// NewMemoryStore returns a new empty MemoryStore.
+//
+// The options configure the rest of the MemoryStore, such as the clock it uses to expire the
+// counters.
+func NewMemoryStore(opts ...Option) *MemoryStore {
+	o := newOptions(opts)
+	return &MemoryStore{
+		mu:        &sync.Mutex{},
+		counters:  make(map[string]memoryCounter),
+		lastSweep: 0,
+		clock:     o.clock,
+	}
+}
+
+// Increment adds n to the counter of the key and returns the new value.
+func (s *MemoryStore) Increment(ctx context.Context, key string, n int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	c, ok := s.get(key, now)
+	if !ok {
+		c = memoryCounter{value: 0, expires: now.Add(ttl)}
+	}
+	c.value += n
+	s.set(key, c, now)
+	return c.value, nil
+}
+
+// CompareAndSwap sets the counter of the key to new if its value is old.
+func (s *MemoryStore) CompareAndSwap(ctx context.Context, key string, old, new int64, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	c, _ := s.get(key, now)
+	if c.value != old {
+		return false, nil
+	}
+	s.set(key, memoryCounter{value: new, expires: now.Add(ttl)}, now)
+	return true, nil
+}
+
+// returns the counter of the key and true, or false if it doesn't exist or expired. Must be called
+// while holding the lock.
+func (s *MemoryStore) get(key string, now time.Time) (memoryCounter, bool) {
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expires) {
+		return memoryCounter{}, false
+	}
+	return c, true
+}
+
+// sets the counter of the key, removing the expired counters whenever their number doubled since
+// the last time. Must be called while holding the lock.
+func (s *MemoryStore) set(key string, c memoryCounter, now time.Time) {
+	s.counters[key] = c
+	if len(s.counters) <= 2*s.lastSweep {
+		return
+	}
+	for k, c := range s.counters {
+		if !now.Before(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+	s.lastSweep = len(s.counters)
+}
@@ -0,0 +1,91 @@
+package rate
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
+)
+
+func TestMemoryStoreIncrement(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	store := NewMemoryStore(WithClock(clock))
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		n       int64
+		want    int64
+	}{
+		{name: "New key", n: 2, want: 2},
+		{name: "Existing key", n: 3, want: 5},
+		{name: "Read", n: 0, want: 5},
+		{name: "Increment keeps the expiry", advance: time.Millisecond * 900, n: 1, want: 6},
+		{name: "Expired key", advance: time.Millisecond * 100, n: 1, want: 1},
+		{name: "Negative", n: -1, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			got, err := store.Increment(ctx, "key", tt.n, time.Second)
+			if err != nil || got != tt.want {
+				t.Errorf("MemoryStore.Increment(%v), want %v, got %v %v", tt.n, tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreCompareAndSwap(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	store := NewMemoryStore(WithClock(clock))
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		old     int64
+		new     int64
+		want    bool
+	}{
+		{name: "Missing key is 0", old: 0, new: 3, want: true},
+		{name: "Old value matches", old: 3, new: 4, want: true},
+		{name: "Old value doesn't match", old: 3, new: 5, want: false},
+		{name: "Expired key is 0", advance: time.Second, old: 0, new: 1, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+			got, err := store.CompareAndSwap(ctx, "key", tt.old, tt.new, time.Second)
+			if err != nil || got != tt.want {
+				t.Errorf("MemoryStore.CompareAndSwap(%v, %v), want %v, got %v %v", tt.old, tt.new, tt.want, got, err)
+			}
+		})
+	}
+	if got, _ := store.Increment(ctx, "key", 0, time.Second); got != 1 {
+		t.Errorf("MemoryStore.Increment(0) after CompareAndSwap, want 1, got %v", got)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	clock := ratetest.NewManualClock(time.Now())
+	store := NewMemoryStore(WithClock(clock))
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		store.Increment(ctx, "old"+strconv.Itoa(i), 1, time.Second)
+	}
+	clock.Advance(time.Second)
+	for i := 0; i < 100; i++ {
+		store.Increment(ctx, "new"+strconv.Itoa(i), 1, time.Second)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if got := len(store.counters); got > 150 {
+		t.Errorf("MemoryStore counters after the first ones expired, want <= 150, got %v", got)
+	}
+}
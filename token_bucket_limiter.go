@@ -0,0 +1,172 @@
+package rate
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// A TokenBucketLimiter is a limiter without an internal buffer that refills permits at a given rate
+// and time interval and allows bursts of up to its burst size
+type TokenBucketLimiter struct {
+	mu       *sync.Mutex
+	rate     int
+	burst    int
+	interval time.Duration
+	tokens   float64
+	last     time.Time
+	clock    Clock
+	closed   bool
+}
+
+// NewTokenBucketLimiter returns a new TokenBucketLimiter given a rate, burst size and time interval.
+//
+// The TokenBucketLimiter holds up to burst permits (tokens) and refills them at the rate per time
+// interval, so it allows a sustained rate of rate per interval with bursts of up to burst permits.
+// The bucket starts full. Unlike the UnbufferedLimiter, which remembers the time of every permit
+// granted in the last interval, the TokenBucketLimiter only keeps the number of tokens and when
+// they were last refilled, so its memory usage does not depend on the rate.
+//
+// If the rate received <= 0 the rate will default to 1, if the burst received <= 0 it will be set
+// to the rate and if the interval received <= 0 it will be set to 1 millisecond. This is to prevent
+// the TokenBucketLimiter from erroring during use without the NewTokenBucketLimiter function
+// returning an error.
+//
+// The options configure the rest of the TokenBucketLimiter, such as the clock it uses.
+func NewTokenBucketLimiter(rate, burst int, interval time.Duration, opts ...Option) *TokenBucketLimiter {
+	o := newOptions(opts)
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	if interval <= 0 {
+		interval = time.Millisecond
+	}
+	return &TokenBucketLimiter{
+		mu:       &sync.Mutex{},
+		rate:     rate,
+		burst:    burst,
+		interval: interval,
+		tokens:   float64(burst),
+		last:     o.clock.Now(),
+		clock:    o.clock,
+		closed:   false,
+	}
+}
+
+// Wait returns when the limiter grants permission or times out.
+//
+// The Wait receiver on the TokenBucketLimiter blocks until permission is granted or the request
+// times out. When permission is granted a nil value is returned and when the request times out a
+// LimiterWaitTimedOut error is returned.
+//
+// Like the UnbufferedLimiter it is thread safe but there is no guarantee as to which order the
+// TokenBucketLimiter will grant permission.
+func (l *TokenBucketLimiter) Wait(timeout *time.Duration) error {
+	if timeout == nil {
+		return l.WaitContext(context.Background())
+	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
+}
+
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// When ctx exceeds its deadline a LimiterWaitTimedOut error wrapping ctx.Err() is returned, and
+// when ctx is cancelled ctx.Err() is returned.
+func (l *TokenBucketLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// If n is greater than the burst size a LimiterRequestTooLarge error is returned since the bucket
+// can never hold enough tokens, and if n <= 0 WaitN returns nil immediately.
+func (l *TokenBucketLimiter) WaitN(ctx context.Context, n int) error {
+	return pollWaitN(ctx, l.clock, n, l.TryWaitN)
+}
+
+// TryWait returns whether or not the TokenBucketLimiter granted permission.
+//
+// The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
+// is nil. If permission is not granted a LimiterOverLimit error is returned and the time duration
+// until enough tokens are refilled. Once the limiter is closed a LimiterClosed error is returned.
+func (l *TokenBucketLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the burst size a
+// LimiterRequestTooLarge error is returned, and if n <= 0 nothing is granted and the error is nil.
+func (l *TokenBucketLimiter) TryWaitN(n int) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	remaining, err := l.checkN(n)
+	if err != nil || n <= 0 {
+		return remaining, err
+	}
+	l.commitN(n)
+	return 0, nil
+}
+
+func (l *TokenBucketLimiter) lock()   { l.mu.Lock() }
+func (l *TokenBucketLimiter) unlock() { l.mu.Unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *TokenBucketLimiter) checkN(n int) (time.Duration, error) {
+	if l.closed {
+		return 0, newClosedError()
+	}
+	if n > l.burst {
+		return 0, &LimiterRequestTooLargeError{Limit: l.burst, message: "permission denied: request exceeds burst"}
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	l.refill(l.clock.Now())
+	if l.tokens >= float64(n) {
+		return 0, nil
+	}
+	remaining := l.refillDuration(float64(n) - l.tokens)
+	return remaining, newOverLimitError(remaining, l.rate)
+}
+
+// takes n tokens from the bucket. Must be called while holding the lock after checkN allowed them.
+func (l *TokenBucketLimiter) commitN(n int) {
+	l.tokens -= float64(n)
+}
+
+// Close closes the TokenBucketLimiter.
+//
+// The TokenBucketLimiter holds no resources so Close only marks the limiter as closed, all
+// subsequent calls to Wait and TryWait return a LimiterClosed error. Calling Close more than once
+// has no effect and the returned error is always nil.
+func (l *TokenBucketLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
+}
+
+// adds the tokens refilled since the last refill without going over the burst size. Must be called
+// while holding the lock.
+func (l *TokenBucketLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last)
+	if elapsed <= 0 {
+		return
+	}
+	l.tokens = math.Min(float64(l.burst), l.tokens+float64(elapsed)*float64(l.rate)/float64(l.interval))
+	l.last = now
+}
+
+// returns the time it takes to refill the given number of tokens, rounded up so that the tokens
+// are available once it passes
+func (l *TokenBucketLimiter) refillDuration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens * float64(l.interval) / float64(l.rate)))
+}
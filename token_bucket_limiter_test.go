@@ -0,0 +1,98 @@
+package rate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketWait(t *testing.T) {
+	tests := []struct {
+		name        string
+		limiter     *TokenBucketLimiter
+		count       int
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "Burst of 10 at 2 per second",
+			limiter:     NewTokenBucketLimiter(2, 10, time.Second),
+			count:       10,
+			minDuration: 0,
+			maxDuration: time.Second / 10,
+		},
+		{
+			name:        "14 requests with burst of 10 at 2 per second",
+			limiter:     NewTokenBucketLimiter(2, 10, time.Second),
+			count:       14,
+			minDuration: time.Second * 2,
+			maxDuration: time.Second * 3,
+		},
+		{
+			name:        "Burst of 0 defaults to the rate",
+			limiter:     NewTokenBucketLimiter(3, 0, time.Second),
+			count:       4,
+			minDuration: time.Second / 3,
+			maxDuration: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			for i := 0; i < tt.count; i++ {
+				if gotErr := tt.limiter.Wait(nil); gotErr != nil {
+					t.Errorf("TokenBucketLimiter.Wait() %v/%v, want nil, got %v", i+1, tt.count, gotErr)
+				}
+			}
+			gotDuration := time.Since(start)
+			if gotDuration < tt.minDuration || gotDuration > tt.maxDuration {
+				t.Errorf("TokenBucketLimiter.Wait(), wantDuration in range (%v, %v) got %v", tt.minDuration, tt.maxDuration, gotDuration)
+			}
+		})
+	}
+}
+
+func TestTokenBucketTryWaitN(t *testing.T) {
+	limiter := NewTokenBucketLimiter(1, 5, time.Second)
+	tests := []struct {
+		name          string
+		n             int
+		wantErr       bool
+		wantRemaining time.Duration
+		wantTooLarge  bool
+	}{
+		{name: "Take 4 of 5", n: 4, wantErr: false, wantRemaining: 0},
+		{name: "Take 3 of the remaining 1", n: 3, wantErr: true, wantRemaining: time.Second * 2},
+		{name: "Take the remaining 1", n: 1, wantErr: false, wantRemaining: 0},
+		{name: "Take more than the burst", n: 6, wantErr: true, wantRemaining: 0, wantTooLarge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRemaining, gotErr := limiter.TryWaitN(tt.n)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("TokenBucketLimiter.TryWaitN(%v), wantErr %v, got %v", tt.n, tt.wantErr, gotErr)
+			}
+			if gotRemaining > tt.wantRemaining || gotRemaining < tt.wantRemaining-time.Second/10 {
+				t.Errorf("TokenBucketLimiter.TryWaitN(%v), wantRemaining about %v, got %v", tt.n, tt.wantRemaining, gotRemaining)
+			}
+			var tooLarge *LimiterRequestTooLargeError
+			if errors.As(gotErr, &tooLarge) != tt.wantTooLarge {
+				t.Errorf("TokenBucketLimiter.TryWaitN(%v), want LimiterRequestTooLargeError %v, got %v", tt.n, tt.wantTooLarge, gotErr)
+			}
+		})
+	}
+}
+
+func TestTokenBucketWaitWithTimeout(t *testing.T) {
+	limiter := NewTokenBucketLimiter(1, 1, time.Second)
+	timeout := time.Second / 2
+	if err := limiter.Wait(&timeout); err != nil {
+		t.Errorf("TokenBucketLimiter.Wait(with timeout), want nil, got %v", err)
+	}
+	var timedOut *LimiterWaitTimedOutError
+	if err := limiter.Wait(&timeout); !errors.As(err, &timedOut) {
+		t.Errorf("TokenBucketLimiter.Wait(with timeout), want LimiterWaitTimedOutError, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package rate
 
 import (
+	"context"
 	"sync"
 	"time"
 )
@@ -12,6 +13,10 @@ type UnbufferedLimiter struct {
 	index      int
 	interval   time.Duration
 	timeStamps []time.Time
+	pending    []time.Time // the times of the reserved permits still in the future, in order
+	clock      Clock
+	closed     bool
+	counters   *counters
 }
 
 // NewUnbufferedLimiter returns a new UnbufferedLimiter given a rate and a time interval.
@@ -22,18 +27,29 @@ type UnbufferedLimiter struct {
 // set to 1 millisecond. This is because the Unbufferedlimiter must have a non-zero rate and
 // interval for simplicity and ease of use to prevent the UnbufferedLimiter from erroring during use
 // and not have the NewUnbufferedLimiter function return an error.
-func NewUnbufferedLimiter(rate int, interval time.Duration) *UnbufferedLimiter {
-	if rate <= 0 {
-		rate = 1
-	}
-	if interval <= 0 {
-		interval = time.Millisecond
-	}
+//
+// The options configure the rest of the UnbufferedLimiter, such as the clock it uses. The rate and
+// interval received take precedence over WithRate. Use NewUnbuffered to have invalid values
+// reported as an error instead.
+func NewUnbufferedLimiter(rate int, interval time.Duration, opts ...Option) *UnbufferedLimiter {
+	o := newOptions(opts)
+	o.rate = rate
+	o.interval = interval
+	o.lenient()
+	return newUnbufferedLimiter(o)
+}
+
+// returns a new UnbufferedLimiter given valid options
+func newUnbufferedLimiter(o *options) *UnbufferedLimiter {
 	return &UnbufferedLimiter{
 		mu:         &sync.Mutex{},
 		index:      0,
-		interval:   interval,
-		timeStamps: make([]time.Time, rate),
+		interval:   o.interval,
+		timeStamps: make([]time.Time, o.rate),
+		pending:    nil,
+		clock:      o.clock,
+		closed:     false,
+		counters:   &counters{},
 	}
 }
 
@@ -48,50 +64,163 @@ func NewUnbufferedLimiter(rate int, interval time.Duration) *UnbufferedLimiter {
 // as to which order the Unbufferedlimiter will grant permission or that permission will ever be
 // granted if there are a large number of requests (request starvation).
 func (l *UnbufferedLimiter) Wait(timeout *time.Duration) error {
-	if timeout != nil {
-		return l.waitWithTimeout(*timeout)
-	}
-	for {
-		remaining, err := l.TryWait()
-		if err == nil {
-			return nil
-		}
-		time.Sleep(remaining)
+	if timeout == nil {
+		return l.WaitContext(context.Background())
 	}
+	ctx, cancel := timeoutContext(l.clock, *timeout)
+	defer cancel()
+	return l.WaitContext(ctx)
 }
 
-// handles the timeout logic for the wait with timeout
-func (l *UnbufferedLimiter) waitWithTimeout(timeout time.Duration) error {
-	start := time.Now()
-	for time.Since(start) < timeout {
-		remaining, err := l.TryWait()
-		if err == nil {
-			return nil
-		}
-		if (time.Since(start) + remaining) > timeout {
-			time.Sleep(timeout - time.Since(start))
-			break
-		}
-		time.Sleep(remaining)
-	}
-	return &LimiterWaitTimedOutError{message: "permission denied: timed out"}
+// WaitContext returns when the limiter grants permission or the context is done.
+//
+// The WaitContext receiver on the UnbufferedLimiter blocks until permission is granted or ctx is
+// done. When permission is granted a nil value is returned. When ctx exceeds its deadline a
+// LimiterWaitTimedOut error wrapping ctx.Err() is returned, and when ctx is cancelled ctx.Err() is
+// returned.
+//
+// WaitContext has the same thread safety and ordering guarantees as Wait.
+func (l *UnbufferedLimiter) WaitContext(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN is like WaitContext but waits for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned since the permits could never be granted, and if n <= 0
+// WaitN returns nil immediately. As with Wait there is no guarantee about the order in which
+// permission is granted, so a request for many permits may wait behind requests for fewer.
+func (l *UnbufferedLimiter) WaitN(ctx context.Context, n int) error {
+	err := pollWaitN(ctx, l.clock, n, l.tryWaitN)
+	l.counters.record(err)
+	return err
 }
 
 // TryWait returns whether or not the Unbufferedlimiter granted permission.
 //
 // The TryWait receiver is non-blocking and returns immediately. If permission is granted the error
 // is nil. If permission is not granted a LimiterOverLimit error is returned and the time duration
-// until the next potential approval can occur.
+// until the next potential approval can occur. Once the limiter is closed a LimiterClosed error is
+// returned.
 //
 // TryWait is a threadsafe function allowing multiple threads to share the same Unbufferedlimiter.
 func (l *UnbufferedLimiter) TryWait() (time.Duration, error) {
+	return l.TryWaitN(1)
+}
+
+// TryWaitN is like TryWait but asks for n permits at once.
+//
+// The n permits are either all granted or none are. If n is greater than the rate a
+// LimiterRequestTooLarge error is returned since the permits could never be granted, and if n <= 0
+// nothing is granted and the error is nil.
+func (l *UnbufferedLimiter) TryWaitN(n int) (time.Duration, error) {
+	remaining, err := l.tryWaitN(n)
+	l.counters.record(err)
+	return remaining, err
+}
+
+// tries to grant n permits without counting the outcome so WaitN can poll it
+func (l *UnbufferedLimiter) tryWaitN(n int) (time.Duration, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	remaining := l.interval - time.Since(l.timeStamps[l.index])
-	if remaining < 0 {
-		l.timeStamps[l.index] = time.Now()
-		l.index = incrementIndex(l.index, len(l.timeStamps))
+	remaining, err := l.checkN(n)
+	if err != nil || n <= 0 {
+		return remaining, err
+	}
+	l.commitN(n)
+	return 0, nil
+}
+
+func (l *UnbufferedLimiter) lock()   { l.mu.Lock() }
+func (l *UnbufferedLimiter) unlock() { l.mu.Unlock() }
+
+// returns whether n permits can be granted without granting them. Must be called while holding the
+// lock.
+func (l *UnbufferedLimiter) checkN(n int) (time.Duration, error) {
+	if l.closed {
+		return 0, newClosedError()
+	}
+	if n > len(l.timeStamps) {
+		return 0, newRequestTooLargeError(len(l.timeStamps))
+	}
+	if n <= 0 {
+		return 0, nil
+	}
+	now := l.clock.Now()
+	l.settle(now)
+	remaining := l.earliest(now, n).Sub(now)
+	if remaining <= 0 {
 		return 0, nil
 	}
-	return remaining, &LimiterOverLimitError{message: "permission denied: limit reached"}
+	return remaining, newOverLimitError(remaining, len(l.timeStamps))
+}
+
+// records that n permits were granted now. Must be called while holding the lock after checkN
+// allowed them.
+func (l *UnbufferedLimiter) commitN(n int) {
+	l.recordN(l.clock.Now(), n)
+}
+
+// records that n permits were granted at the given time, which must not be before the most recent
+// time stamp. Must be called while holding the lock.
+func (l *UnbufferedLimiter) recordN(at time.Time, n int) {
+	for i := 0; i < n; i++ {
+		l.timeStamps[l.index] = at
+		l.index = incrementIndex(l.index, len(l.timeStamps))
+	}
+}
+
+// SetRate changes the rate and time interval of the UnbufferedLimiter.
+//
+// The permissions granted recently are kept so the new rate is enforced immediately, if more
+// permissions than the new rate were granted in the last interval further requests wait until
+// enough of them are older than the interval. A rate or interval <= 0 returns a LimiterConfig error
+// and leaves the limiter unchanged.
+func (l *UnbufferedLimiter) SetRate(rate int, interval time.Duration) error {
+	o := &options{rate: rate, interval: interval}
+	if err := o.validateRate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settle(l.clock.Now())
+	l.timeStamps, l.index = resizeTimeStamps(l.timeStamps, l.index, rate)
+	l.interval = interval
+	return nil
+}
+
+// Stats returns a snapshot of the UnbufferedLimiter.
+//
+// The UnbufferedLimiter has no buffer so Queued, Capacity and BufferFull are always 0.
+func (l *UnbufferedLimiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := Stats{
+		Rate:     len(l.timeStamps),
+		Interval: l.interval,
+	}
+	now := l.clock.Now()
+	l.settle(now)
+	s.Available, s.NextAvailable = availableTimeStamps(l.timeStamps, l.index, l.interval, now)
+	// the pending reservations take some of the permits available from the time stamps alone
+	for s.Available > 0 && !l.fits(now, s.Available) {
+		s.Available--
+	}
+	if s.Available == 0 {
+		s.NextAvailable = l.earliest(now, 1)
+	}
+	l.counters.fill(&s)
+	return s
+}
+
+// Close closes the UnbufferedLimiter.
+//
+// The UnbufferedLimiter holds no resources so Close only marks the limiter as closed, all
+// subsequent calls to Wait and TryWait return a LimiterClosed error. Calling Close more than once
+// has no effect and the returned error is always nil.
+func (l *UnbufferedLimiter) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	return nil
 }
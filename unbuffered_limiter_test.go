@@ -1,8 +1,12 @@
 package rate
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/yisroelshulman/rate/ratetest"
 )
 
 func TestUnbufferedWait(t *testing.T) {
@@ -38,14 +42,6 @@ func TestUnbufferedWait(t *testing.T) {
 			maxDuration: time.Second * 3,
 			wantErr:     false,
 		},
-		{
-			name:        "Interval of 0",
-			limiter:     NewUnbufferedLimiter(1, 0),
-			count:       5,
-			minDuration: time.Millisecond * 4,
-			maxDuration: time.Millisecond * 5,
-			wantErr:     false,
-		},
 		{
 			name:        "500 requests in 1 second",
 			limiter:     NewUnbufferedLimiter(500, time.Second),
@@ -165,3 +161,195 @@ func TestUnbufferedTryWait(t *testing.T) {
 		})
 	}
 }
+
+func TestUnbufferedWaitContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		limiter      *UnbufferedLimiter
+		count        int
+		cancelAt     time.Duration
+		deadline     bool
+		wantErr      []bool
+		wantErrIs    error
+		wantTimedOut bool
+	}{
+		{
+			name:     "Within limit",
+			limiter:  NewUnbufferedLimiter(3, time.Second),
+			count:    3,
+			cancelAt: time.Second / 2,
+			wantErr:  []bool{false, false, false},
+		},
+		{
+			name:      "Cancelled while waiting",
+			limiter:   NewUnbufferedLimiter(1, time.Second),
+			count:     2,
+			cancelAt:  time.Second / 2,
+			wantErr:   []bool{false, true},
+			wantErrIs: context.Canceled,
+		},
+		{
+			name:         "Deadline exceeded while waiting",
+			limiter:      NewUnbufferedLimiter(1, time.Second),
+			count:        2,
+			cancelAt:     time.Second / 2,
+			deadline:     true,
+			wantErr:      []bool{false, true},
+			wantErrIs:    context.DeadlineExceeded,
+			wantTimedOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if tt.deadline {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.cancelAt)
+			} else {
+				ctx, cancel = context.WithCancel(context.Background())
+				time.AfterFunc(tt.cancelAt, cancel)
+			}
+			defer cancel()
+
+			var gotErr error
+			for i := 0; i < tt.count; i++ {
+				gotErr = tt.limiter.WaitContext(ctx)
+				if (gotErr != nil) != tt.wantErr[i] {
+					t.Errorf("UnbufferedLimiter.WaitContext() %v/%v, wantErr %v, got %v", i+1, tt.count, tt.wantErr[i], gotErr)
+				}
+			}
+			if tt.wantErrIs != nil && !errors.Is(gotErr, tt.wantErrIs) {
+				t.Errorf("UnbufferedLimiter.WaitContext(), want errors.Is %v, got %v", tt.wantErrIs, gotErr)
+			}
+			var timedOut *LimiterWaitTimedOutError
+			if errors.As(gotErr, &timedOut) != tt.wantTimedOut {
+				t.Errorf("UnbufferedLimiter.WaitContext(), want LimiterWaitTimedOutError %v, got %v", tt.wantTimedOut, gotErr)
+			}
+		})
+	}
+}
+
+func TestUnbufferedClose(t *testing.T) {
+	limiter := NewUnbufferedLimiter(1, time.Second)
+	if err := limiter.Wait(nil); err != nil {
+		t.Fatalf("UnbufferedLimiter.Wait(), want nil, got %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- limiter.Wait(nil)
+	}()
+	time.Sleep(time.Second / 10)
+	if err := limiter.Close(); err != nil {
+		t.Errorf("UnbufferedLimiter.Close(), want nil, got %v", err)
+	}
+	if err := limiter.Close(); err != nil {
+		t.Errorf("UnbufferedLimiter.Close() second call, want nil, got %v", err)
+	}
+
+	var closed *LimiterClosedError
+	if err := <-done; !errors.As(err, &closed) {
+		t.Errorf("UnbufferedLimiter.Wait() while closing, want LimiterClosedError, got %v", err)
+	}
+	if _, err := limiter.TryWait(); !errors.As(err, &closed) {
+		t.Errorf("UnbufferedLimiter.TryWait() after Close, want LimiterClosedError, got %v", err)
+	}
+}
+
+func TestUnbufferedTryWaitN(t *testing.T) {
+	limiter := NewUnbufferedLimiter(5, time.Second)
+	tests := []struct {
+		name          string
+		n             int
+		wantErr       bool
+		wantRemaining bool
+		wantTooLarge  bool
+	}{
+		{name: "Take 3 of 5", n: 3, wantErr: false, wantRemaining: false},
+		{name: "Take 3 of the remaining 2", n: 3, wantErr: true, wantRemaining: true},
+		{name: "Take the remaining 2", n: 2, wantErr: false, wantRemaining: false},
+		{name: "Take 0", n: 0, wantErr: false, wantRemaining: false},
+		{name: "Take more than the rate", n: 6, wantErr: true, wantRemaining: false, wantTooLarge: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotRemaining, gotErr := limiter.TryWaitN(tt.n)
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("UnbufferedLimiter.TryWaitN(%v), wantErr %v, got %v", tt.n, tt.wantErr, gotErr)
+			}
+			if (gotRemaining > 0) != tt.wantRemaining {
+				t.Errorf("UnbufferedLimiter.TryWaitN(%v), wantRemaining %v, got %v", tt.n, tt.wantRemaining, gotRemaining)
+			}
+			var tooLarge *LimiterRequestTooLargeError
+			if errors.As(gotErr, &tooLarge) != tt.wantTooLarge {
+				t.Errorf("UnbufferedLimiter.TryWaitN(%v), want LimiterRequestTooLargeError %v, got %v", tt.n, tt.wantTooLarge, gotErr)
+			}
+		})
+	}
+}
+
+func TestUnbufferedSetRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int
+		taken    int
+		newRate  int
+		wantErrs []bool
+	}{
+		{
+			name:     "Lower the rate below the recent grants",
+			rate:     3,
+			taken:    3,
+			newRate:  1,
+			wantErrs: []bool{true},
+		},
+		{
+			name:     "Raise the rate",
+			rate:     2,
+			taken:    2,
+			newRate:  4,
+			wantErrs: []bool{false, false, true},
+		},
+		{
+			name:     "Lower the rate above the recent grants",
+			rate:     4,
+			taken:    1,
+			newRate:  2,
+			wantErrs: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := ratetest.NewManualClock(time.Now())
+			limiter := NewUnbufferedLimiter(tt.rate, time.Second, WithClock(clock))
+			for i := 0; i < tt.taken; i++ {
+				if _, err := limiter.TryWait(); err != nil {
+					t.Fatalf("UnbufferedLimiter.TryWait(), want nil, got %v", err)
+				}
+			}
+			if err := limiter.SetRate(tt.newRate, time.Second); err != nil {
+				t.Fatalf("UnbufferedLimiter.SetRate(), want nil, got %v", err)
+			}
+			for i, wantErr := range tt.wantErrs {
+				if _, gotErr := limiter.TryWait(); (gotErr != nil) != wantErr {
+					t.Errorf("UnbufferedLimiter.TryWait() %v/%v after SetRate, wantErr %v, got %v", i+1, len(tt.wantErrs), wantErr, gotErr)
+				}
+			}
+			clock.Advance(time.Second)
+			for i := 0; i < tt.newRate; i++ {
+				if _, err := limiter.TryWait(); err != nil {
+					t.Errorf("UnbufferedLimiter.TryWait() %v/%v after the interval, want nil, got %v", i+1, tt.newRate, err)
+				}
+			}
+		})
+	}
+
+	limiter := NewUnbufferedLimiter(1, time.Second)
+	var configErr *LimiterConfigError
+	if err := limiter.SetRate(0, time.Second); !errors.As(err, &configErr) {
+		t.Errorf("UnbufferedLimiter.SetRate(0), want LimiterConfigError, got %v", err)
+	}
+}